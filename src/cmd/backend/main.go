@@ -49,5 +49,10 @@ func main() {
 
 	http.HandleFunc("/", srv.HandleRequest)
 	logger.Printf("Server is ready to accept connections on :%s", port)
-	logger.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
+	// бэкенд принимает и HTTP/1.1, и HTTP/2 без шифрования (h2c) от балансировщика
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	httpServer := &http.Server{Addr: fmt.Sprintf(":%s", port), Protocols: &protocols}
+	logger.Fatal(httpServer.ListenAndServe())
 }
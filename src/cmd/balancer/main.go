@@ -1,42 +1,345 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
+	"maps"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/admin"
 	"github.com/pozedorum/load_balancer/internal/balancer"
 	"github.com/pozedorum/load_balancer/internal/server"
 	"github.com/pozedorum/load_balancer/pkg/logger"
+	"github.com/pozedorum/load_balancer/pkg/proxyproto"
+	"github.com/pozedorum/load_balancer/pkg/ratelimit"
+	"github.com/pozedorum/load_balancer/pkg/realip"
+	"github.com/pozedorum/load_balancer/pkg/tlsutil"
 )
 
 func main() {
-	configs, err := config.LoadServerConfigList("config/servers.json")
+	balancerConfig, err := config.LoadBalancerConfig("config/balancer.json")
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		log.Fatalf("Failed to load balancer config: %v", err)
 	}
-
-	servers := make([]*server.Server, 0, len(configs))
-	for _, cfg := range configs {
-		servers = append(servers, server.New(strconv.Itoa(cfg.Port)))
+	resolver, err := realip.NewResolver(balancerConfig.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
 	}
 
-	lb := balancer.NewRoundRobinBalancer(servers)
 	// Инициализация логгера
 	serverID := "0"
-	port := "8080"
-	log.Printf("Load balancer started on :%s", port)
+	port := strconv.Itoa(balancerConfig.Port)
 	logger, err := logger.New("balancer", serverID, port)
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Close()
 	logger.SetGlobal()
-	// Упрощенный обработчик без возврата ошибки
-	http.HandleFunc("/", lb.HandleRequest)
 
-	log.Printf("Load balancer started on :%s", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
+	// Пулы бэкендов: пул default по умолчанию создается из servers.json с общими настройками
+	poolConfigs := make(map[string]config.PoolConfig, len(balancerConfig.Pools)+1)
+	maps.Copy(poolConfigs, balancerConfig.Pools)
+	if _, ok := poolConfigs[balancer.DefaultPool]; !ok {
+		configs, err := config.LoadServerConfigList("config/servers.json")
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		poolConfigs[balancer.DefaultPool] = config.PoolConfig{
+			Servers:        configs,
+			RateLimitState: balancerConfig.RateLimitState,
+			Canary:         balancerConfig.Canary,
+			Mirror:         balancerConfig.Mirror,
+		}
+	}
+
+	// общий транспорт до бэкендов: соединения переиспользуются между запросами
+	transports := server.NewTransportPool(balancerConfig.Upstream)
+	pools := make(map[string]*balancer.RoundRobinBalancer, len(poolConfigs))
+	for name, poolConfig := range poolConfigs {
+		lb, err := newPool(poolConfig, balancerConfig, resolver, transports)
+		if err != nil {
+			log.Fatalf("Failed to configure pool %s: %v", name, err)
+		}
+		pools[name] = lb
+	}
+	// Копирование запросов в теневые пулы (после создания всех пулов)
+	for name, poolConfig := range poolConfigs {
+		if poolConfig.Mirror == nil {
+			continue
+		}
+		target, ok := pools[poolConfig.Mirror.Pool]
+		if !ok {
+			log.Fatalf("Failed to configure pool %s: unknown mirror pool %q", name, poolConfig.Mirror.Pool)
+		}
+		if err := pools[name].SetMirror(poolConfig.Mirror.Pool, target, *poolConfig.Mirror); err != nil {
+			log.Fatalf("Failed to configure pool %s: %v", name, err)
+		}
+	}
+
+	// Обработка сигналов: сохраняем состояние rate limiter пулов перед завершением
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		for name, poolConfig := range poolConfigs {
+			if poolConfig.RateLimitState == "" {
+				continue
+			}
+			if err := pools[name].RateLimiter().SaveSnapshot(poolConfig.RateLimitState); err != nil {
+				log.Printf("Failed to save rate limit state of pool %s: %v", name, err)
+			}
+		}
+		logger.Close()
+		os.Exit(0)
+	}()
+
+	// SIGHUP: перечитывание весов канареечных групп из config/balancer.json
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			reloadCanaryWeights(pools)
+		}
+	}()
+
+	for _, tcpConfig := range balancerConfig.TCP {
+		startTCPProxy(tcpConfig, transports)
+	}
+	for _, udpConfig := range balancerConfig.UDP {
+		startUDPProxy(udpConfig, transports)
+	}
+
+	if balancerConfig.AdminAddr != "" {
+		// без токена любой процесс на хосте мог бы менять лимиты и банить клиентов
+		if balancerConfig.AdminToken == "" && !balancerConfig.AdminInsecure {
+			log.Fatalf("Admin API on %s requires admin_token (or admin_insecure for debugging)", balancerConfig.AdminAddr)
+		}
+		adminAPI := admin.New(balancerConfig.AdminToken)
+		for name, lb := range pools {
+			adminAPI.AddPool(name, lb)
+		}
+		go func() {
+			log.Printf("Admin API started on %s", balancerConfig.AdminAddr)
+			log.Fatal(http.ListenAndServe(balancerConfig.AdminAddr, adminAPI))
+		}()
+	}
+
+	// HTTP/2 принимается поверх TLS, а при h2c - и без шифрования
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(balancerConfig.H2C)
+
+	// Дополнительные порты со своими маршрутами
+	for _, listenerConfig := range balancerConfig.Listeners {
+		router, err := balancer.NewRouter(listenerConfig.Routes, listenerConfig.Pool, pools)
+		if err != nil {
+			log.Fatalf("Invalid routes of listener %s: %v", listenerConfig.Listen, err)
+		}
+		listener := listen(listenerConfig.Listen, balancerConfig.ProxyProtocol, resolver)
+		go func() {
+			log.Fatal(serve(listener, router, listenerConfig.TLS, &protocols))
+		}()
+	}
+
+	router, err := balancer.NewRouter(balancerConfig.Routes, balancer.DefaultPool, pools)
+	if err != nil {
+		log.Fatalf("Invalid routes: %v", err)
+	}
+	listener := listen(":"+port, balancerConfig.ProxyProtocol, resolver)
+	log.Fatal(serve(listener, router, balancerConfig.TLS, &protocols))
+}
+
+// newPool создает балансировщик пула со своими серверами, стратегией и лимитами
+// (приоритеты, сброс нагрузки и очередь настраиваются одинаково для всех пулов)
+func newPool(cfg config.PoolConfig, balancerConfig *config.BalancerConfig, resolver *realip.Resolver,
+	transports *server.TransportPool) (*balancer.RoundRobinBalancer, error) {
+	servers := make([]*server.Server, 0, len(cfg.Servers))
+	for _, serverConfig := range cfg.Servers {
+		srv, err := server.NewFromConfig(serverConfig, transports)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, srv)
+	}
+
+	strategyName := cfg.Strategy
+	if strategyName == "" {
+		strategyName = balancerConfig.Strategy
+	}
+	strategy, err := balancer.NewStrategy(strategyName)
+	if err != nil {
+		return nil, err
+	}
+
+	rateLimits := cfg.RateLimits
+	if rateLimits == "" {
+		rateLimits = ratelimit.RateLimitsConfigPath
+	}
+	lb := balancer.NewRoundRobinBalancerWithLimiter(servers,
+		ratelimit.NewRateLimiterFromFile(rateLimits, 5*time.Minute, 5*time.Minute))
+	lb.SetStrategy(strategy)
+	lb.SetUpgradeIdleTimeout(balancerConfig.UpgradeIdleTimeout.Duration)
+	lb.SetResolver(resolver)
+	lb.SetPriorities(balancer.NewPriorityResolver(balancerConfig.Priority, resolver))
+	if balancerConfig.Shedding != nil {
+		lb.SetShedder(balancer.NewShedder(*balancerConfig.Shedding))
+	}
+	if balancerConfig.Queue != nil {
+		lb.EnableQueue(*balancerConfig.Queue)
+	}
+
+	if cfg.Canary != nil {
+		if err := lb.SetCanary(*cfg.Canary); err != nil {
+			return nil, err
+		}
+	}
+
+	// Восстановление состояния rate limiter и периодическое сохранение
+	if cfg.RateLimitState != "" {
+		if err := lb.RateLimiter().LoadSnapshot(cfg.RateLimitState); err != nil {
+			log.Printf("Failed to restore rate limit state: %v", err)
+		}
+		if interval := balancerConfig.RateLimitStateInterval.Duration; interval > 0 {
+			lb.RateLimiter().StartSnapshots(cfg.RateLimitState, interval)
+		}
+	}
+	return lb, nil
+}
+
+// reloadCanaryWeights перечитывает конфиг и применяет новые веса канареечных групп
+// (остальные настройки применяются только при перезапуске)
+func reloadCanaryWeights(pools map[string]*balancer.RoundRobinBalancer) {
+	balancerConfig, err := config.LoadBalancerConfig("config/balancer.json")
+	if err != nil {
+		log.Printf("Failed to reload balancer config: %v", err)
+		return
+	}
+	canaries := make(map[string]*config.CanaryConfig, len(balancerConfig.Pools)+1)
+	for name, poolConfig := range balancerConfig.Pools {
+		canaries[name] = poolConfig.Canary
+	}
+	if _, ok := canaries[balancer.DefaultPool]; !ok {
+		canaries[balancer.DefaultPool] = balancerConfig.Canary
+	}
+
+	for name, lb := range pools {
+		canary, cfg := lb.Canary(), canaries[name]
+		if canary == nil || cfg == nil {
+			continue
+		}
+		if err := canary.SetWeight(cfg.Weight); err != nil {
+			log.Printf("Invalid canary weight of pool %s: %v", name, err)
+			continue
+		}
+		log.Printf("Canary weight of pool %s reloaded: %.1f%%", name, cfg.Weight)
+	}
+}
+
+// listen открывает порт; заголовок PROXY protocol принимается только от доверенных прокси
+func listen(addr string, proxyProtocol bool, resolver *realip.Resolver) net.Listener {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", addr, err)
+	}
+	if proxyProtocol {
+		listener = proxyproto.NewListener(listener, resolver.IsTrustedAddr)
+		log.Printf("PROXY protocol enabled for trusted proxies on %s", addr)
+	}
+	return listener
+}
+
+// serve принимает HTTP-запросы на порту, с TLS-терминацией, если она настроена
+func serve(listener net.Listener, handler http.Handler, tlsConfig *config.TLSConfig, protocols *http.Protocols) error {
+	srv := &http.Server{Handler: handler, Protocols: protocols}
+	if tlsConfig != nil {
+		var err error
+		srv.TLSConfig, err = newTLSConfig(tlsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		log.Printf("Load balancer started on %s (TLS)", listener.Addr())
+		return srv.ServeTLS(listener, "", "")
+	}
+
+	log.Printf("Load balancer started on %s", listener.Addr())
+	return srv.Serve(listener)
+}
+
+// newTLSConfig загружает сертификаты и запускает их перечитывание при изменении файлов
+func newTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	entries := make([]tlsutil.Entry, 0, len(cfg.Certificates))
+	for _, cert := range cfg.Certificates {
+		entries = append(entries, tlsutil.Entry{Hosts: cert.Hosts, CertFile: cert.CertFile, KeyFile: cert.KeyFile})
+	}
+	store, err := tlsutil.NewCertStore(entries)
+	if err != nil {
+		return nil, err
+	}
+	if interval := cfg.ReloadInterval.Duration; interval > 0 {
+		go store.Watch(interval, nil)
+	}
+	return tlsutil.NewServerConfig(store, cfg.MinVersion, cfg.CipherSuites)
+}
+
+// startTCPProxy запускает L4-балансировщик TCP
+func startTCPProxy(cfg config.TCPConfig, transports *server.TransportPool) {
+	servers := newL4Servers(cfg.Name, cfg.Servers, transports)
+	proxy, err := balancer.NewTCPProxy(cfg, servers)
+	if err != nil {
+		log.Fatalf("Invalid TCP %s config: %v", cfg.Name, err)
+	}
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", cfg.Listen, err)
+	}
+	go func() {
+		log.Printf("TCP %s started on %s", cfg.Name, cfg.Listen)
+		log.Fatal(proxy.Serve(listener))
+	}()
+}
+
+// startUDPProxy запускает балансировщик UDP
+func startUDPProxy(cfg config.UDPConfig, transports *server.TransportPool) {
+	servers := newL4Servers(cfg.Name, cfg.Servers, transports)
+	proxy, err := balancer.NewUDPProxy(cfg, servers)
+	if err != nil {
+		log.Fatalf("Invalid UDP %s config: %v", cfg.Name, err)
+	}
+	addr, err := net.ResolveUDPAddr("udp", cfg.Listen)
+	if err != nil {
+		log.Fatalf("Invalid UDP %s listen address: %v", cfg.Name, err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s/udp: %v", cfg.Listen, err)
+	}
+	go func() {
+		log.Printf("UDP %s started on %s", cfg.Name, cfg.Listen)
+		log.Fatal(proxy.Serve(conn))
+	}()
+}
+
+// newL4Servers создает серверы TCP/UDP балансировщика (health check по умолчанию - tcp)
+func newL4Servers(name string, configs []config.ServerConfig, transports *server.TransportPool) []*server.Server {
+	servers := make([]*server.Server, 0, len(configs))
+	for _, serverConfig := range configs {
+		if serverConfig.HealthCheck == "" {
+			serverConfig.HealthCheck = server.HealthCheckTCP
+		}
+		srv, err := server.NewFromConfig(serverConfig, transports)
+		if err != nil {
+			log.Fatalf("Failed to configure %s backend: %v", name, err)
+		}
+		servers = append(servers, srv)
+	}
+	return servers
 }
@@ -3,15 +3,33 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // структура для парсинга конфигов из файла
 type ServerConfig struct {
-	ID   int `json:"id"`
-	Port int `json:"port"`
+	ID          int               `json:"id"`
+	Port        int               `json:"port"`
+	Host        string            `json:"host,omitempty"`         // адрес бэкенда (по умолчанию localhost)
+	Scheme      string            `json:"scheme,omitempty"`       // http или https (по умолчанию https, если задан tls)
+	Protocol    string            `json:"protocol,omitempty"`     // http1 (по умолчанию), h2 или h2c
+	HealthCheck string            `json:"health_check,omitempty"` // тип health check: http, tcp, grpc или none
+	GRPCService string            `json:"grpc_service,omitempty"` // сервис для gRPC health check (пустой - весь сервер)
+	TLS         *BackendTLSConfig `json:"tls,omitempty"`          // TLS/mTLS до бэкенда
+}
+
+// настройки TLS-соединения балансировщика с бэкендом
+type BackendTLSConfig struct {
+	CAFile             string `json:"ca_file"`              // CA для проверки сертификата бэкенда (пустой - системные)
+	CertFile           string `json:"cert_file"`            // клиентский сертификат для mTLS
+	KeyFile            string `json:"key_file"`             // ключ клиентского сертификата
+	ServerName         string `json:"server_name"`          // имя для SNI и проверки сертификата (вместо host)
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // не проверять сертификат бэкенда (только для отладки)
 }
 
 // Загрузка списка конфигов из файла
@@ -54,41 +72,358 @@ func FindPortInConfig(path, serverID string) (string, error) {
 	return "", errors.New("no such serverId in config")
 }
 
+// Duration - обёртка над time.Duration для чтения из JSON строк вида "1m", "500ms"
+// (число трактуется как количество секунд)
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		d.Duration = time.Duration(value * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
+
+// настройки лимита клиента:
+// Algorithm - алгоритм ограничения (token_bucket, sliding_window_log, sliding_window_counter, gcra),
+// Capacity - емкость бакета / количество запросов в окне / допустимый всплеск для GCRA,
+// Rate - скорость пополнения (токенов в секунду, может быть дробной),
+// Window - размер окна для sliding window алгоритмов,
+// MaxInFlight - максимальное количество одновременно выполняемых запросов клиента (0 - без ограничения),
+// Class - имя класса клиентов, настройки которого берутся за основу
 type ClientConfig struct {
-	Capacity int `json:"capacity"`
-	Rate     int `json:"rate"`
+	Class     string   `json:"class,omitempty"`
+	Algorithm string   `json:"algorithm,omitempty"`
+	Capacity  int      `json:"capacity,omitempty"`
+	Rate      float64  `json:"rate,omitempty"`
+	Window    Duration `json:"window,omitzero"`
+
+	MaxInFlight int `json:"max_in_flight,omitempty"`
 }
 
+// настройки ограничения запросов:
+// Key - из чего составляется ключ клиента (ip, api_key, jwt_sub, path, header:<имя>),
+// ключи в Clients записываются в том же формате (например "api_key:abc" или "api_key:abc|path:/process")
+// Clients - лимиты по точному ключу или по CIDR ("10.0.0.0/8"),
+// Groups - именованные наборы CIDR с общими лимитами,
+// Allow/Deny - списки адресов, CIDR и групп ("group:office"), которым разрешён/запрещён доступ
 type RateLimitConfig struct {
+	Key     []string                `json:"key,omitempty"`
+	JWT     *JWTConfig              `json:"jwt,omitempty"`
 	Default ClientConfig            `json:"default"`
+	Classes map[string]ClientConfig `json:"classes"`
+	Groups  map[string]GroupConfig  `json:"groups"`
 	Clients map[string]ClientConfig `json:"clients"`
+	Allow   []string                `json:"allow,omitempty"`
+	Deny    []string                `json:"deny,omitempty"`
+	Costs   []CostRule              `json:"costs,omitempty"`
 }
 
-var (
-	rateLimitConfig     *RateLimitConfig
-	rateLimitConfigOnce sync.Once
-)
+// правило стоимости запроса в токенах:
+// Method и Path (префикс пути) - к каким запросам применяется правило (пустые - к любым),
+// Tokens - фиксированная стоимость, PerExecutionTime - ещё один токен за каждые
+// PerExecutionTime запрошенного времени выполнения (заголовок Execution-Time)
+type CostRule struct {
+	Method           string   `json:"method,omitempty"`
+	Path             string   `json:"path,omitempty"`
+	Tokens           int      `json:"tokens,omitempty"`
+	PerExecutionTime Duration `json:"per_execution_time,omitzero"`
+}
 
-func LoadRateLimitConfig(RateLimitsConfigPath string) (*RateLimitConfig, error) {
-	var loadErr error
-	rateLimitConfigOnce.Do(func() {
-		file, err := os.Open(RateLimitsConfigPath)
-		if err != nil {
-			loadErr = err
-			return
-		}
-		defer file.Close()
+// проверка подписи JWT для ключа jwt_sub: Secret - ключ HS256,
+// PublicKeyFile - открытый ключ RS256 или ES256 (P-256) в PEM
+type JWTConfig struct {
+	Secret        string `json:"secret,omitempty"`
+	PublicKeyFile string `json:"public_key_file,omitempty"`
+}
 
-		var cfg RateLimitConfig
-		if err = json.NewDecoder(file).Decode(&cfg); err != nil {
-			loadErr = err
-			return
-		}
-		rateLimitConfig = &cfg
-	})
-	return rateLimitConfig, loadErr
+// группа клиентов: список CIDR и общие для них настройки лимита
+type GroupConfig struct {
+	ClientConfig
+	CIDRs []string `json:"cidrs"`
 }
 
+// Resolve подставляет в настройки клиента параметры его класса,
+// явно заданные у клиента значения имеют приоритет
+func (c *RateLimitConfig) Resolve(client ClientConfig) (ClientConfig, error) {
+	if client.Class == "" {
+		return client, nil
+	}
+	class, ok := c.Classes[client.Class]
+	if !ok {
+		return client, fmt.Errorf("unknown rate limit class %q", client.Class)
+	}
+	if client.Algorithm != "" {
+		class.Algorithm = client.Algorithm
+	}
+	if client.Capacity != 0 {
+		class.Capacity = client.Capacity
+	}
+	if client.Rate != 0 {
+		class.Rate = client.Rate
+	}
+	if client.Window.Duration != 0 {
+		class.Window = client.Window
+	}
+	if client.MaxInFlight != 0 {
+		class.MaxInFlight = client.MaxInFlight
+	}
+	class.Class = client.Class
+	return class, nil
+}
+
+// файл настроек rate limiting по умолчанию (пул default)
+const DefaultRateLimitsPath = "config/rate_limits.json"
+
+// последние загруженные настройки из DefaultRateLimitsPath (для GetConfig)
+var defaultRateLimitConfig atomic.Pointer[RateLimitConfig]
+
+// Загрузка настроек rate limiting из файла (у каждого пула может быть свой файл)
+func LoadRateLimitConfig(path string) (*RateLimitConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cfg RateLimitConfig
+	if err = json.NewDecoder(file).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if filepath.Clean(path) == DefaultRateLimitsPath {
+		defaultRateLimitConfig.Store(&cfg)
+	}
+	return &cfg, nil
+}
+
+// GetConfig возвращает настройки rate limiting пула default, загруженные из
+// config/rate_limits.json (nil - файл ещё не загружался).
+//
+// Deprecated: у каждого пула свои настройки лимитов, используйте LoadRateLimitConfig.
 func GetConfig() *RateLimitConfig {
-	return rateLimitConfig
+	return defaultRateLimitConfig.Load()
+}
+
+// настройки самого балансировщика
+type BalancerConfig struct {
+	Port               int                   `json:"port"`                 // порт, на котором принимаются запросы
+	TLS                *TLSConfig            `json:"tls"`                  // TLS-терминация (nil - обычный HTTP)
+	H2C                bool                  `json:"h2c"`                  // принимать HTTP/2 без шифрования (h2c)
+	Upstream           UpstreamConfig        `json:"upstream"`             // настройки соединений с бэкендами
+	Strategy           string                `json:"strategy"`             // стратегия выбора сервера: round_robin (по умолчанию) или least_connections
+	UpgradeIdleTimeout Duration              `json:"upgrade_idle_timeout"` // таймаут простоя WebSocket-соединений (0 - без таймаута)
+	TCP                []TCPConfig           `json:"tcp"`                  // L4-балансировка TCP
+	UDP                []UDPConfig           `json:"udp"`                  // балансировка UDP
+	Pools              map[string]PoolConfig `json:"pools"`                // именованные пулы бэкендов (пул default по умолчанию - servers.json)
+	Canary             *CanaryConfig         `json:"canary"`               // канареечная группа пула default
+	Mirror             *MirrorConfig         `json:"mirror"`               // копирование запросов пула default в теневой пул
+	Routes             []RouteConfig         `json:"routes"`               // выбор пула на основном порту (без совпадений - пул default)
+	Listeners          []ListenerConfig      `json:"listeners"`            // дополнительные HTTP-порты со своими маршрутами
+	TrustedProxies     []string              `json:"trusted_proxies"`      // CIDR доверенных прокси (X-Forwarded-For, Forwarded, PROXY protocol)
+	ProxyProtocol      bool                  `json:"proxy_protocol"`       // ожидать заголовок HAProxy PROXY protocol от доверенных прокси
+	AdminAddr          string                `json:"admin_addr"`           // адрес admin API (пустой - admin API выключен)
+	AdminToken         string                `json:"admin_token"`          // Bearer-токен для admin API (обязателен, если не задан admin_insecure)
+	AdminInsecure      bool                  `json:"admin_insecure"`       // разрешить admin API без токена (только для отладки)
+
+	RateLimitState         string   `json:"rate_limit_state"`          // файл состояния rate limiter (пустой - не сохранять)
+	RateLimitStateInterval Duration `json:"rate_limit_state_interval"` // интервал сохранения состояния
+
+	Priority PriorityConfig  `json:"priority"` // определение приоритета запросов
+	Shedding *SheddingConfig `json:"shedding"` // адаптивный сброс нагрузки (nil - выключен)
+	Queue    *QueueConfig    `json:"queue"`    // очередь запросов с приоритетами (nil - запросы отправляются сразу)
+}
+
+// настройки очереди запросов:
+// Workers - сколько запросов одновременно отправляется на бэкенды (0 - по количеству бэкендов пула),
+// MaxQueued - максимальный размер очереди (0 - без ограничения),
+// Weights - веса клиентов (ключ как в rate_limits.json) в справедливой очереди, по умолчанию 1
+type QueueConfig struct {
+	Workers   int                `json:"workers"`
+	MaxQueued int                `json:"max_queued"`
+	Weights   map[string]float64 `json:"weights"`
+}
+
+// настройки TLS-терминации на балансировщике
+type TLSConfig struct {
+	Certificates   []CertificateConfig `json:"certificates"`    // сертификаты, первый используется по умолчанию
+	MinVersion     string              `json:"min_version"`     // минимальная версия TLS ("1.2", "1.3")
+	CipherSuites   []string            `json:"cipher_suites"`   // разрешённые наборы шифров для TLS 1.2 (пустой - по умолчанию Go)
+	ReloadInterval Duration            `json:"reload_interval"` // интервал проверки изменения файлов сертификатов
+}
+
+// именованный пул бэкендов со своей стратегией, health check и лимитами
+type PoolConfig struct {
+	Servers        []ServerConfig `json:"servers"`          // бэкенды в формате servers.json
+	Strategy       string         `json:"strategy"`         // стратегия выбора сервера (пустая - общая стратегия)
+	RateLimits     string         `json:"rate_limits"`      // файл лимитов (пустой - config/rate_limits.json)
+	RateLimitState string         `json:"rate_limit_state"` // файл состояния rate limiter пула (пустой - не сохранять)
+	Canary         *CanaryConfig  `json:"canary"`           // доля запросов на канареечную группу серверов (nil - выключено)
+	Mirror         *MirrorConfig  `json:"mirror"`           // копирование запросов в теневой пул (nil - выключено)
+}
+
+// копирование (зеркалирование) запросов в теневой пул, ответы теневого пула отбрасываются
+type MirrorConfig struct {
+	Pool        string   `json:"pool"`          // название теневого пула
+	Percent     float64  `json:"percent"`       // процент копируемых запросов (0-100)
+	MaxInFlight int      `json:"max_in_flight"` // максимум одновременных копий (по умолчанию 100), лишние отбрасываются
+	MaxBodySize int64    `json:"max_body_size"` // максимальный размер тела копируемого запроса (по умолчанию 1 МБ)
+	Timeout     Duration `json:"timeout"`       // таймаут запроса в теневой пул (по умолчанию 10s)
+}
+
+// канареечная группа серверов пула
+type CanaryConfig struct {
+	Servers  []int                 `json:"servers"`  // ID серверов канареечной группы
+	Weight   float64               `json:"weight"`   // процент запросов на канареечную группу (0-100)
+	Sticky   string                `json:"sticky"`   // закрепление клиента: "" - нет, cookie или client (по ключу клиента)
+	Rollback *CanaryRollbackConfig `json:"rollback"` // автоматический откат (nil - выключен)
+}
+
+// автоматический откат канареечной группы при росте доли ошибок
+type CanaryRollbackConfig struct {
+	ErrorRate   float64  `json:"error_rate"`   // доля ошибок (0-1), при превышении которой вес сбрасывается в 0
+	MinRequests int      `json:"min_requests"` // минимум запросов в окне для принятия решения
+	Window      Duration `json:"window"`       // окно подсчёта ошибок (по умолчанию 1m)
+	Webhook     string   `json:"webhook"`      // URL, на который отправляется POST при откате (пустой - только лог)
+}
+
+// маршрут: подходящие запросы передаются в пул или на часть его серверов
+type RouteConfig struct {
+	Priority int          `json:"priority"` // маршруты с большим приоритетом проверяются раньше, при равенстве - по порядку
+	Hosts    []string     `json:"hosts"`    // имена хостов (виртуальные хосты), поддерживается *.example.com; пустой - любой хост
+	Path     string       `json:"path"`     // префикс пути (пустой - любой путь)
+	Match    *MatchConfig `json:"match"`    // дополнительные условия (nil - без условий)
+	Pool     string       `json:"pool"`     // название пула
+	Servers  []int        `json:"servers"`  // ID серверов пула, на которые идут запросы (пустой - все)
+	Headers  *HeaderRules `json:"headers"`  // изменение заголовков запроса и ответа (nil - без изменений)
+}
+
+// изменение заголовков запроса перед проксированием и ответа перед отправкой клиенту.
+// В значениях подставляются {client_ip}, {request_id}, {backend_id} и {timestamp}
+type HeaderRules struct {
+	Request  HeaderActions `json:"request"`
+	Response HeaderActions `json:"response"`
+}
+
+// действия с заголовками, выполняются в порядке remove, set, add
+type HeaderActions struct {
+	Add    map[string]string `json:"add"`    // добавить значение к существующим
+	Set    map[string]string `json:"set"`    // заменить значение
+	Remove []string          `json:"remove"` // удалить заголовок
+}
+
+// условия маршрута: все заданные условия должны выполняться (AND), из any - хотя бы одно (OR).
+// Значение заголовка, параметра или cookie: "*" - задано с любым значением, "~regex" - регулярное выражение,
+// иначе - точное совпадение
+type MatchConfig struct {
+	Methods   []string          `json:"methods"`    // методы запроса
+	PathRegex string            `json:"path_regex"` // регулярное выражение для пути
+	Headers   map[string]string `json:"headers"`    // заголовки
+	Query     map[string]string `json:"query"`      // параметры запроса
+	Cookies   map[string]string `json:"cookies"`    // cookie
+	All       []MatchConfig     `json:"all"`        // вложенные условия, должны выполняться все
+	Any       []MatchConfig     `json:"any"`        // вложенные условия, должно выполняться хотя бы одно
+}
+
+// дополнительный HTTP-порт балансировщика
+type ListenerConfig struct {
+	Listen string        `json:"listen"` // адрес, на котором принимаются запросы
+	TLS    *TLSConfig    `json:"tls"`    // TLS-терминация (nil - обычный HTTP)
+	Routes []RouteConfig `json:"routes"` // маршруты, проверяются по порядку
+	Pool   string        `json:"pool"`   // пул для запросов без подходящего маршрута (пустой - default)
+}
+
+// настройки L4-балансировки TCP
+type TCPConfig struct {
+	Name           string         `json:"name"`            // название (для логов)
+	Listen         string         `json:"listen"`          // адрес, на котором принимаются соединения
+	Strategy       string         `json:"strategy"`        // стратегия выбора сервера
+	ConnectTimeout Duration       `json:"connect_timeout"` // таймаут соединения с бэкендом
+	IdleTimeout    Duration       `json:"idle_timeout"`    // таймаут простоя соединения (по умолчанию 5m)
+	Servers        []ServerConfig `json:"servers"`         // бэкенды (health check по умолчанию tcp)
+}
+
+// настройки балансировки UDP
+type UDPConfig struct {
+	Name           string         `json:"name"`            // название (для логов)
+	Listen         string         `json:"listen"`          // адрес, на котором принимаются датаграммы
+	Strategy       string         `json:"strategy"`        // стратегия выбора сервера для новой сессии
+	SessionTimeout Duration       `json:"session_timeout"` // время жизни сессии клиента без датаграмм
+	MaxSessions    int            `json:"max_sessions"`    // максимальное количество сессий (по умолчанию 1024)
+	Servers        []ServerConfig `json:"servers"`         // бэкенды (health check по умолчанию tcp)
+}
+
+// настройки общего транспорта до бэкендов (нулевые значения - значения по умолчанию)
+type UpstreamConfig struct {
+	MaxIdleConns          int      `json:"max_idle_conns"`
+	MaxIdleConnsPerHost   int      `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int      `json:"max_conns_per_host"`
+	IdleConnTimeout       Duration `json:"idle_conn_timeout"`
+	DialTimeout           Duration `json:"dial_timeout"`
+	TLSHandshakeTimeout   Duration `json:"tls_handshake_timeout"`
+	ResponseHeaderTimeout Duration `json:"response_header_timeout"`
+}
+
+// сертификат и имена хостов (SNI), для которых он выдаётся
+type CertificateConfig struct {
+	Hosts    []string `json:"hosts"`
+	CertFile string   `json:"cert_file"`
+	KeyFile  string   `json:"key_file"`
+}
+
+// настройки приоритета запросов: заголовок и приоритеты по префиксу пути
+type PriorityConfig struct {
+	Header string          `json:"header"`
+	Routes []PriorityRoute `json:"routes"`
+}
+
+// приоритет (low, normal, high, critical) для запросов с путём, начинающимся с Path
+type PriorityRoute struct {
+	Path     string `json:"path"`
+	Priority string `json:"priority"`
+}
+
+// настройки адаптивного сброса нагрузки (AIMD-лимит одновременных запросов к бэкендам)
+type SheddingConfig struct {
+	InitialLimit  int      `json:"initial_limit"`
+	MinLimit      int      `json:"min_limit"`
+	MaxLimit      int      `json:"max_limit"`
+	TargetLatency Duration `json:"target_latency"` // задержка ожидания, выше которой лимит уменьшается
+	Backoff       float64  `json:"backoff"`        // множитель уменьшения лимита (0..1)
+}
+
+// Загрузка настроек балансировщика, если файла нет - используются значения по умолчанию
+func LoadBalancerConfig(path string) (*BalancerConfig, error) {
+	cfg := &BalancerConfig{
+		Port:                   8080,
+		RateLimitStateInterval: Duration{Duration: time.Minute},
+	}
+	file, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(file, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
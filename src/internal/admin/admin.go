@@ -0,0 +1,286 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/balancer"
+	"github.com/pozedorum/load_balancer/pkg/ratelimit"
+)
+
+var (
+	ErrClientNotFound = errors.New("client not found")
+	ErrPoolNotFound   = errors.New("pool not found")
+	ErrNoCanary       = errors.New("canary is not configured for the pool")
+	ErrNoMirror       = errors.New("mirror is not configured for the pool")
+)
+
+// пул, к которому относится запрос, если параметр pool не задан
+const defaultPool = "default"
+
+// Admin - HTTP API для просмотра и управления состоянием балансировщика.
+// Ключ клиента передаётся в пути в экранированном виде (например, "path%3A%2Fprocess"),
+// пул - в параметре pool (по умолчанию default).
+type Admin struct {
+	mux   *http.ServeMux                          // маршруты admin API
+	token string                                  // токен доступа (пустой - без проверки)
+	pools map[string]*balancer.RoundRobinBalancer // пулы балансировщика
+}
+
+// запрос на изменение веса канареечной группы
+type canaryRequest struct {
+	Weight *float64 `json:"weight"`
+}
+
+// запрос на блокировку клиента
+type banRequest struct {
+	Duration config.Duration `json:"duration"`
+}
+
+// New создает admin API, пулы добавляются через AddPool до запуска
+func New(token string) *Admin {
+	a := &Admin{
+		mux:   http.NewServeMux(),
+		token: token,
+		pools: make(map[string]*balancer.RoundRobinBalancer),
+	}
+	a.mux.HandleFunc("GET /admin/pools", a.listPools)
+	a.mux.HandleFunc("GET /admin/pools/{pool}/canary", a.getCanary)
+	a.mux.HandleFunc("PUT /admin/pools/{pool}/canary", a.setCanary)
+	a.mux.HandleFunc("GET /admin/pools/{pool}/mirror", a.getMirror)
+	a.mux.HandleFunc("GET /admin/ratelimit/clients", a.listClients)
+	a.mux.HandleFunc("GET /admin/ratelimit/clients/{key}", a.getClient)
+	a.mux.HandleFunc("PUT /admin/ratelimit/clients/{key}/limits", a.setLimits)
+	a.mux.HandleFunc("DELETE /admin/ratelimit/clients/{key}/limits", a.clearLimits)
+	a.mux.HandleFunc("POST /admin/ratelimit/clients/{key}/reset", a.resetClient)
+	a.mux.HandleFunc("POST /admin/ratelimit/clients/{key}/ban", a.banClient)
+	a.mux.HandleFunc("DELETE /admin/ratelimit/clients/{key}/ban", a.unbanClient)
+	return a
+}
+
+// AddPool добавляет пул балансировщика
+func (a *Admin) AddPool(name string, pool *balancer.RoundRobinBalancer) {
+	a.pools[name] = pool
+}
+
+// ServeHTTP проверяет токен и передаёт запрос в маршруты
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.token != "" {
+		expected := "Bearer " + a.token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// список пулов
+func (a *Admin) listPools(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(a.pools))
+	for name := range a.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, names)
+}
+
+// rateLimiter возвращает ограничитель пула из параметра pool, при ошибке отправляет 404
+func (a *Admin) rateLimiter(w http.ResponseWriter, r *http.Request) (*ratelimit.RateLimiter, bool) {
+	pool := r.URL.Query().Get("pool")
+	if pool == "" {
+		pool = defaultPool
+	}
+	lb, ok := a.pools[pool]
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrPoolNotFound)
+		return nil, false
+	}
+	return lb.RateLimiter(), true
+}
+
+// canary возвращает разделение запросов пула из пути, при ошибке отправляет 404
+func (a *Admin) canary(w http.ResponseWriter, r *http.Request) (*balancer.Canary, bool) {
+	lb, ok := a.pools[r.PathValue("pool")]
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrPoolNotFound)
+		return nil, false
+	}
+	if lb.Canary() == nil {
+		writeError(w, http.StatusNotFound, ErrNoCanary)
+		return nil, false
+	}
+	return lb.Canary(), true
+}
+
+// состояние канареечной группы пула
+func (a *Admin) getCanary(w http.ResponseWriter, r *http.Request) {
+	canary, ok := a.canary(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, canary.Status())
+}
+
+// изменение веса канареечной группы (сбрасывает признак автоматического отката)
+func (a *Admin) setCanary(w http.ResponseWriter, r *http.Request) {
+	canary, ok := a.canary(w, r)
+	if !ok {
+		return
+	}
+	var req canaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Weight == nil {
+		writeError(w, http.StatusBadRequest, errors.New("weight is required"))
+		return
+	}
+	if err := canary.SetWeight(*req.Weight); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("Admin: canary weight of pool %s set to %.1f%%", r.PathValue("pool"), *req.Weight)
+	writeJSON(w, http.StatusOK, canary.Status())
+}
+
+// метрики копирования запросов пула в теневой пул
+func (a *Admin) getMirror(w http.ResponseWriter, r *http.Request) {
+	lb, ok := a.pools[r.PathValue("pool")]
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrPoolNotFound)
+		return
+	}
+	if lb.Mirror() == nil {
+		writeError(w, http.StatusNotFound, ErrNoMirror)
+		return
+	}
+	writeJSON(w, http.StatusOK, lb.Mirror().Stats())
+}
+
+// список активных клиентов
+func (a *Admin) listClients(w http.ResponseWriter, r *http.Request) {
+	rateLimiter, ok := a.rateLimiter(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, rateLimiter.Clients())
+}
+
+// сведения об одном клиенте
+func (a *Admin) getClient(w http.ResponseWriter, r *http.Request) {
+	rateLimiter, ok := a.rateLimiter(w, r)
+	if !ok {
+		return
+	}
+	info, ok := rateLimiter.ClientInfo(r.PathValue("key"))
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrClientNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// переопределение лимитов клиента
+func (a *Admin) setLimits(w http.ResponseWriter, r *http.Request) {
+	rateLimiter, ok := a.rateLimiter(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	var limits config.ClientConfig
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := rateLimiter.SetLimits(key, limits); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("Admin: limits for %s set to %+v", key, limits)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// возврат к лимитам из конфига
+func (a *Admin) clearLimits(w http.ResponseWriter, r *http.Request) {
+	rateLimiter, ok := a.rateLimiter(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	rateLimiter.ClearLimits(key)
+	log.Printf("Admin: limits override for %s removed", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// сброс лимита клиента
+func (a *Admin) resetClient(w http.ResponseWriter, r *http.Request) {
+	rateLimiter, ok := a.rateLimiter(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	if !rateLimiter.ResetClient(key) {
+		writeError(w, http.StatusNotFound, ErrClientNotFound)
+		return
+	}
+	log.Printf("Admin: limits for %s reset", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// временная блокировка клиента
+func (a *Admin) banClient(w http.ResponseWriter, r *http.Request) {
+	rateLimiter, ok := a.rateLimiter(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Duration.Duration <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("duration must be positive"))
+		return
+	}
+	until := rateLimiter.Ban(key, req.Duration.Duration)
+	log.Printf("Admin: client %s banned until %s", key, until.Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, map[string]time.Time{"banned_until": until})
+}
+
+// снятие блокировки
+func (a *Admin) unbanClient(w http.ResponseWriter, r *http.Request) {
+	rateLimiter, ok := a.rateLimiter(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	if !rateLimiter.Unban(key) {
+		writeError(w, http.StatusNotFound, ErrClientNotFound)
+		return
+	}
+	log.Printf("Admin: client %s unbanned", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeJSON отправляет ответ в формате JSON
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Admin: failed to write response: %v", err)
+	}
+}
+
+// writeError отправляет ошибку в формате JSON
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
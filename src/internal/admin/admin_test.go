@@ -0,0 +1,245 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/balancer"
+	"github.com/pozedorum/load_balancer/internal/server"
+	"github.com/pozedorum/load_balancer/pkg/ratelimit"
+)
+
+const testToken = "secret"
+
+const testLimits = `{
+	"default": {"capacity": 10, "rate": 1},
+	"classes": {
+		"api-quota": {"algorithm": "sliding_window_counter", "capacity": 60, "window": "1m"}
+	}
+}`
+
+// newTestPool создает пул из двух серверов (ID 1 и 2) с ограничителем из testLimits
+func newTestPool(t *testing.T) *balancer.RoundRobinBalancer {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rate_limits.json")
+	if err := os.WriteFile(path, []byte(testLimits), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rl := ratelimit.NewRateLimiterFromFile(path, time.Minute, time.Minute)
+	t.Cleanup(rl.Stop)
+
+	transports := server.NewTransportPool(config.UpstreamConfig{})
+	var servers []*server.Server
+	for id := 1; id <= 2; id++ {
+		srv, err := server.NewFromConfig(config.ServerConfig{ID: id, Host: "127.0.0.1", Port: 9000 + id,
+			HealthCheck: server.HealthCheckNone}, transports)
+		if err != nil {
+			t.Fatal(err)
+		}
+		servers = append(servers, srv)
+	}
+	return balancer.NewRoundRobinBalancerWithLimiter(servers, rl)
+}
+
+// newTestAdmin создает admin API с пулами default (с канареечной группой) и plain
+func newTestAdmin(t *testing.T, token string) (*Admin, *balancer.RoundRobinBalancer) {
+	t.Helper()
+	pool := newTestPool(t)
+	if err := pool.SetCanary(config.CanaryConfig{Servers: []int{2}, Weight: 10}); err != nil {
+		t.Fatal(err)
+	}
+	a := New(token)
+	a.AddPool("default", pool)
+	a.AddPool("plain", newTestPool(t))
+	return a, pool
+}
+
+// do выполняет запрос к admin API с токеном testToken
+func do(a *Admin, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuth(t *testing.T) {
+	a, _ := newTestAdmin(t, testToken)
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"token without scheme", testToken, http.StatusUnauthorized},
+		{"valid token", "Bearer " + testToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin/pools", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	// без токена проверка отключена
+	open, _ := newTestAdmin(t, "")
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/pools", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status without configured token = %d, want 200", w.Code)
+	}
+}
+
+func TestListPools(t *testing.T) {
+	a, _ := newTestAdmin(t, testToken)
+	w := do(a, http.MethodGet, "/admin/pools", "")
+	var names []string
+	if err := json.NewDecoder(w.Body).Decode(&names); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "default,plain" {
+		t.Fatalf("pools = %v", names)
+	}
+}
+
+func TestClientRoutes(t *testing.T) {
+	a, pool := newTestAdmin(t, testToken)
+	pool.RateLimiter().TakeTokens("known", 3)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"list clients", http.MethodGet, "/admin/ratelimit/clients", "", http.StatusOK},
+		{"get client", http.MethodGet, "/admin/ratelimit/clients/known", "", http.StatusOK},
+		{"unknown client", http.MethodGet, "/admin/ratelimit/clients/unknown", "", http.StatusNotFound},
+		{"unknown pool", http.MethodGet, "/admin/ratelimit/clients/known?pool=missing", "", http.StatusNotFound},
+		{"client of other pool", http.MethodGet, "/admin/ratelimit/clients/known?pool=plain", "", http.StatusNotFound},
+		{"reset", http.MethodPost, "/admin/ratelimit/clients/known/reset", "", http.StatusNoContent},
+		{"reset unknown client", http.MethodPost, "/admin/ratelimit/clients/unknown/reset", "", http.StatusNotFound},
+		{"ban", http.MethodPost, "/admin/ratelimit/clients/banned/ban", `{"duration": "1h"}`, http.StatusOK},
+		{"ban without duration", http.MethodPost, "/admin/ratelimit/clients/known/ban", `{}`, http.StatusBadRequest},
+		{"ban invalid body", http.MethodPost, "/admin/ratelimit/clients/known/ban", `{`, http.StatusBadRequest},
+		{"unban", http.MethodDelete, "/admin/ratelimit/clients/banned/ban", "", http.StatusNoContent},
+		{"unban unknown client", http.MethodDelete, "/admin/ratelimit/clients/unknown/ban", "", http.StatusNotFound},
+		{"clear limits", http.MethodDelete, "/admin/ratelimit/clients/known/limits", "", http.StatusNoContent},
+		{"escaped key", http.MethodPost, "/admin/ratelimit/clients/path%3A%2Fprocess/ban", `{"duration": "1m"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(a, tt.method, tt.path, tt.body); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	if info, _ := pool.RateLimiter().ClientInfo("known"); info.Remaining != 10 {
+		t.Errorf("remaining after reset = %d, want 10", info.Remaining)
+	}
+	if info, _ := pool.RateLimiter().ClientInfo("banned"); info.BannedUntil != nil {
+		t.Error("client is still banned after unban")
+	}
+	if info, ok := pool.RateLimiter().ClientInfo("path:/process"); !ok || info.BannedUntil == nil {
+		t.Error("escaped key is not decoded")
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		want  int
+		check func(t *testing.T, limits config.ClientConfig)
+	}{
+		{"explicit limits", `{"capacity": 3, "rate": 1}`, http.StatusNoContent, func(t *testing.T, limits config.ClientConfig) {
+			if limits != (config.ClientConfig{Capacity: 3, Rate: 1}) {
+				t.Fatalf("limits = %+v", limits)
+			}
+		}},
+		{"class", `{"class": "api-quota"}`, http.StatusNoContent, func(t *testing.T, limits config.ClientConfig) {
+			if limits.Algorithm != ratelimit.AlgorithmSlidingWindowCounter || limits.Capacity != 60 {
+				t.Fatalf("class is not resolved: %+v", limits)
+			}
+		}},
+		{"unknown class", `{"class": "missing"}`, http.StatusBadRequest, nil},
+		{"invalid limits", `{"capacity": 0}`, http.StatusBadRequest, nil},
+		{"invalid body", `{`, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, pool := newTestAdmin(t, testToken)
+			w := do(a, http.MethodPut, "/admin/ratelimit/clients/client/limits", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+			if tt.check == nil {
+				return
+			}
+			pool.RateLimiter().TakeToken("client")
+			info, _ := pool.RateLimiter().ClientInfo("client")
+			tt.check(t, info.Limits)
+		})
+	}
+}
+
+func TestCanaryRoutes(t *testing.T) {
+	a, pool := newTestAdmin(t, testToken)
+
+	w := do(a, http.MethodGet, "/admin/pools/default/canary", "")
+	var status balancer.CanaryStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || status.Weight != 10 || len(status.Servers) != 1 || status.Servers[0] != 2 {
+		t.Fatalf("canary status = %d %+v", w.Code, status)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"set weight", http.MethodPut, "/admin/pools/default/canary", `{"weight": 25}`, http.StatusOK},
+		{"weight above 100", http.MethodPut, "/admin/pools/default/canary", `{"weight": 150}`, http.StatusBadRequest},
+		{"negative weight", http.MethodPut, "/admin/pools/default/canary", `{"weight": -1}`, http.StatusBadRequest},
+		{"missing weight", http.MethodPut, "/admin/pools/default/canary", `{}`, http.StatusBadRequest},
+		{"invalid body", http.MethodPut, "/admin/pools/default/canary", `{`, http.StatusBadRequest},
+		{"pool without canary", http.MethodGet, "/admin/pools/plain/canary", "", http.StatusNotFound},
+		{"set weight without canary", http.MethodPut, "/admin/pools/plain/canary", `{"weight": 25}`, http.StatusNotFound},
+		{"unknown pool", http.MethodGet, "/admin/pools/missing/canary", "", http.StatusNotFound},
+		{"pool without mirror", http.MethodGet, "/admin/pools/default/mirror", "", http.StatusNotFound},
+		{"mirror of unknown pool", http.MethodGet, "/admin/pools/missing/mirror", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(a, tt.method, tt.path, tt.body); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	// неверные значения не меняют вес
+	if weight := pool.Canary().Status().Weight; weight != 25 {
+		t.Fatalf("canary weight = %v, want 25", weight)
+	}
+}
@@ -0,0 +1,246 @@
+package balancer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// Способы закрепления клиента за стороной разделения
+const (
+	StickyNone   = ""
+	StickyCookie = "cookie" // сторона запоминается в cookie
+	StickyClient = "client" // сторона вычисляется по ключу клиента (как для rate limiting)
+)
+
+// cookie со стороной разделения
+const canaryCookie = "lb_canary"
+
+// окно подсчёта ошибок по умолчанию
+const defaultCanaryWindow = time.Minute
+
+var ErrInvalidWeight = errors.New("canary weight must be between 0 and 100")
+
+// Canary делит запросы пула между основной и канареечной группами серверов
+// и откатывает канареечную группу, если доля ошибок в ней превышает порог
+type Canary struct {
+	stable   *RoundRobinBalancer // основная группа
+	canary   *RoundRobinBalancer // канареечная группа
+	servers  []int               // ID серверов канареечной группы
+	sticky   string
+	rollback *config.CanaryRollbackConfig
+	window   time.Duration
+
+	mu          sync.Mutex
+	weight      float64   // процент запросов на канареечную группу
+	rolledBack  bool      // вес сброшен автоматическим откатом
+	windowStart time.Time // начало текущего окна подсчёта ошибок
+	requests    int       // запросов канареечной группы в окне
+	errors      int       // ошибок канареечной группы в окне
+}
+
+// CanaryStatus - состояние разделения для admin API
+type CanaryStatus struct {
+	Weight     float64 `json:"weight"`
+	Servers    []int   `json:"servers"`
+	Sticky     string  `json:"sticky,omitempty"`
+	RolledBack bool    `json:"rolled_back"`
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"`
+	ErrorRate  float64 `json:"error_rate"`
+}
+
+// SetCanary включает разделение запросов пула между основной и канареечной группами
+func (b *RoundRobinBalancer) SetCanary(cfg config.CanaryConfig) error {
+	if len(cfg.Servers) == 0 {
+		return errors.New("canary servers are not set")
+	}
+	if cfg.Weight < 0 || cfg.Weight > 100 {
+		return ErrInvalidWeight
+	}
+	if cfg.Sticky != StickyNone && cfg.Sticky != StickyCookie && cfg.Sticky != StickyClient {
+		return fmt.Errorf("unknown canary sticky mode %q", cfg.Sticky)
+	}
+
+	var stableIDs []int
+	for _, s := range b.servers {
+		if !slices.Contains(cfg.Servers, s.ID) {
+			stableIDs = append(stableIDs, s.ID)
+		}
+	}
+	if len(stableIDs) == 0 {
+		return errors.New("canary group contains all servers of the pool")
+	}
+	stable, err := b.Subset(stableIDs)
+	if err != nil {
+		return err
+	}
+	canarySubset, err := b.Subset(cfg.Servers)
+	if err != nil {
+		return fmt.Errorf("canary: %w", err)
+	}
+
+	c := &Canary{
+		stable:      stable,
+		canary:      canarySubset,
+		servers:     slices.Clone(cfg.Servers),
+		sticky:      cfg.Sticky,
+		rollback:    cfg.Rollback,
+		window:      defaultCanaryWindow,
+		weight:      cfg.Weight,
+		windowStart: time.Now(),
+	}
+	if cfg.Rollback != nil && cfg.Rollback.Window.Duration > 0 {
+		c.window = cfg.Rollback.Window.Duration
+	}
+	canarySubset.observe = c.observe
+	b.canary = c
+	return nil
+}
+
+// Canary возвращает разделение запросов пула (nil - выключено)
+func (b *RoundRobinBalancer) Canary() *Canary {
+	return b.canary
+}
+
+// ServeHTTP передаёт запрос в основную или канареечную группу
+func (c *Canary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.pick(w, r) {
+		c.canary.HandleRequest(w, r)
+		return
+	}
+	c.stable.HandleRequest(w, r)
+}
+
+// pick выбирает сторону: true - канареечная группа
+func (c *Canary) pick(w http.ResponseWriter, r *http.Request) bool {
+	weight := c.Weight()
+	if weight == 0 {
+		return false
+	}
+	switch c.sticky {
+	case StickyCookie:
+		if cookie, err := r.Cookie(canaryCookie); err == nil {
+			return cookie.Value == "canary"
+		}
+		toCanary := rand.Float64()*100 < weight
+		value := "stable"
+		if toCanary {
+			value = "canary"
+		}
+		http.SetCookie(w, &http.Cookie{Name: canaryCookie, Value: value, Path: "/", HttpOnly: true})
+		return toCanary
+	case StickyClient:
+		// клиент попадает в одну и ту же точку [0, 100): при росте веса клиенты только переходят в канареечную группу
+		h := fnv.New32a()
+		h.Write([]byte(c.stable.rateLimiter.Key(r)))
+		return float64(h.Sum32()%10000)/100 < weight
+	default:
+		return rand.Float64()*100 < weight
+	}
+}
+
+// Weight возвращает текущий процент запросов на канареечную группу
+func (c *Canary) Weight() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.weight
+}
+
+// SetWeight меняет процент запросов на канареечную группу во время работы,
+// признак отката и счётчики ошибок сбрасываются
+func (c *Canary) SetWeight(weight float64) error {
+	if weight < 0 || weight > 100 {
+		return ErrInvalidWeight
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.weight = weight
+	c.rolledBack = false
+	c.resetWindow(time.Now())
+	return nil
+}
+
+// Status возвращает состояние разделения
+func (c *Canary) Status() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status()
+}
+
+// status собирает состояние, вызывается под мьютексом
+func (c *Canary) status() CanaryStatus {
+	status := CanaryStatus{
+		Weight:     c.weight,
+		Servers:    c.servers,
+		Sticky:     c.sticky,
+		RolledBack: c.rolledBack,
+		Requests:   c.requests,
+		Errors:     c.errors,
+	}
+	if c.requests > 0 {
+		status.ErrorRate = float64(c.errors) / float64(c.requests)
+	}
+	return status
+}
+
+// observe учитывает результат запроса канареечной группы и при превышении порога ошибок
+// сбрасывает её вес в 0
+func (c *Canary) observe(failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.windowStart) >= c.window {
+		c.resetWindow(now)
+	}
+	c.requests++
+	if failed {
+		c.errors++
+	}
+
+	if c.rollback == nil || c.rolledBack || c.weight == 0 || c.requests < c.rollback.MinRequests {
+		return
+	}
+	if rate := float64(c.errors) / float64(c.requests); rate > c.rollback.ErrorRate {
+		c.weight = 0
+		c.rolledBack = true
+		status := c.status()
+		log.Printf("Canary servers %v rolled back: error rate %.2f over %d requests", c.servers, rate, c.requests)
+		if c.rollback.Webhook != "" {
+			go notifyRollback(c.rollback.Webhook, status)
+		}
+	}
+}
+
+// resetWindow начинает новое окно подсчёта ошибок, вызывается под мьютексом
+func (c *Canary) resetWindow(now time.Time) {
+	c.windowStart = now
+	c.requests = 0
+	c.errors = 0
+}
+
+// отправка состояния канареечной группы на webhook после отката
+func notifyRollback(url string, status CanaryStatus) {
+	body, _ := json.Marshal(status)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Canary rollback webhook failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Canary rollback webhook returned status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,218 @@
+package balancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/server"
+)
+
+// ok и fail - обработчики бэкендов с успешным ответом и ошибкой 500
+var (
+	okHandler   = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	failHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "fail", http.StatusInternalServerError)
+	})
+)
+
+// waitCanary ждёт, пока состояние канареечной группы не будет удовлетворять условию
+func waitCanary(t *testing.T, c *Canary, cond func(CanaryStatus) bool) CanaryStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := c.Status()
+		if cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("canary status = %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCanaryRollback(t *testing.T) {
+	webhook := make(chan CanaryStatus, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status CanaryStatus
+		json.NewDecoder(r.Body).Decode(&status)
+		webhook <- status
+	}))
+	defer hook.Close()
+
+	b := newTestPool(t, okHandler, failHandler)
+	err := b.SetCanary(config.CanaryConfig{
+		Servers:  []int{2},
+		Weight:   100,
+		Rollback: &config.CanaryRollbackConfig{ErrorRate: 0.5, MinRequests: 3, Webhook: hook.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := b.Canary()
+
+	for range 3 {
+		if rec := serve(b, httptest.NewRequest(http.MethodPost, "/process", nil)); rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202", rec.Code)
+		}
+	}
+	status := waitCanary(t, c, func(s CanaryStatus) bool { return s.RolledBack })
+	if status.Weight != 0 || status.Errors != 3 || status.Requests != 3 {
+		t.Fatalf("status after rollback = %+v", status)
+	}
+	select {
+	case sent := <-webhook:
+		if !sent.RolledBack || sent.Weight != 0 {
+			t.Fatalf("webhook status = %+v", sent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("rollback webhook is not called")
+	}
+
+	// после отката запросы идут в основную группу, SetWeight снимает признак отката
+	if c.pick(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)) {
+		t.Fatal("request is sent to the rolled back canary")
+	}
+	if err := c.SetWeight(10); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.Status(); status.RolledBack || status.Weight != 10 || status.Requests != 0 {
+		t.Fatalf("status after SetWeight = %+v", status)
+	}
+}
+
+// успешные ответы и ошибки ниже порога не откатывают канареечную группу
+func TestCanaryNoRollback(t *testing.T) {
+	b := newTestPool(t, okHandler, okHandler)
+	err := b.SetCanary(config.CanaryConfig{
+		Servers:  []int{2},
+		Weight:   100,
+		Rollback: &config.CanaryRollbackConfig{ErrorRate: 0.5, MinRequests: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		serve(b, httptest.NewRequest(http.MethodPost, "/process", nil))
+	}
+	status := waitCanary(t, b.Canary(), func(s CanaryStatus) bool { return s.Requests == 3 })
+	if status.RolledBack || status.Errors != 0 || status.Weight != 100 {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+// запросы, не дошедшие до бэкенда, не учитываются в доле ошибок
+func TestCanaryCountsOnlyBackendResponses(t *testing.T) {
+	backend := httptest.NewServer(okHandler)
+	defer backend.Close()
+	b := newPoolOf(t,
+		newTestServer(t, 1, backend.Listener.Addr().String(), server.HealthCheckNone),
+		newTestServer(t, 2, closedAddr(t), server.HealthCheckTCP))
+	err := b.SetCanary(config.CanaryConfig{
+		Servers:  []int{2},
+		Weight:   100,
+		Rollback: &config.CanaryRollbackConfig{ErrorRate: 0.5, MinRequests: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setTestLimits(t, b, 0)
+	if rec := serve(b, httptest.NewRequest(http.MethodPost, "/process", nil)); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if status := b.Canary().Status(); status.Requests != 0 || status.RolledBack {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestCanarySticky(t *testing.T) {
+	b := newTestPool(t, okHandler, okHandler)
+
+	t.Run("cookie", func(t *testing.T) {
+		if err := b.SetCanary(config.CanaryConfig{Servers: []int{2}, Weight: 50, Sticky: StickyCookie}); err != nil {
+			t.Fatal(err)
+		}
+		c := b.Canary()
+		rec := httptest.NewRecorder()
+		first := c.pick(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != canaryCookie {
+			t.Fatalf("cookies = %v", cookies)
+		}
+		for range 20 {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(cookies[0])
+			rec := httptest.NewRecorder()
+			if c.pick(rec, r) != first {
+				t.Fatal("client with cookie changed side")
+			}
+			if rec.Header().Get("Set-Cookie") != "" {
+				t.Fatal("cookie is set again")
+			}
+		}
+	})
+
+	t.Run("client", func(t *testing.T) {
+		if err := b.SetCanary(config.CanaryConfig{Servers: []int{2}, Weight: 50, Sticky: StickyClient}); err != nil {
+			t.Fatal(err)
+		}
+		c := b.Canary()
+		var requests []*http.Request
+		canary := make(map[*http.Request]bool)
+		for i := range 50 {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "10.0.0." + strconv.Itoa(i) + ":1234"
+			requests = append(requests, r)
+			canary[r] = c.pick(httptest.NewRecorder(), r)
+			for range 5 {
+				if c.pick(httptest.NewRecorder(), r) != canary[r] {
+					t.Fatalf("client %s changed side", r.RemoteAddr)
+				}
+			}
+		}
+		count := 0
+		for _, toCanary := range canary {
+			if toCanary {
+				count++
+			}
+		}
+		if count == 0 || count == len(requests) {
+			t.Fatalf("%d of %d clients in canary", count, len(requests))
+		}
+
+		// при росте веса клиенты только переходят в канареечную группу
+		c.SetWeight(80)
+		for _, r := range requests {
+			if canary[r] && !c.pick(httptest.NewRecorder(), r) {
+				t.Fatalf("client %s left canary when weight increased", r.RemoteAddr)
+			}
+		}
+	})
+}
+
+func TestSetCanaryErrors(t *testing.T) {
+	b := newTestPool(t, okHandler, okHandler)
+	tests := []struct {
+		name string
+		cfg  config.CanaryConfig
+	}{
+		{"no servers", config.CanaryConfig{Weight: 10}},
+		{"weight above 100", config.CanaryConfig{Servers: []int{2}, Weight: 101}},
+		{"negative weight", config.CanaryConfig{Servers: []int{2}, Weight: -1}},
+		{"unknown sticky", config.CanaryConfig{Servers: []int{2}, Sticky: "ip"}},
+		{"all servers", config.CanaryConfig{Servers: []int{1, 2}}},
+		{"unknown server", config.CanaryConfig{Servers: []int{3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := b.SetCanary(tt.cfg); err == nil {
+				t.Fatal("invalid canary config is accepted")
+			}
+		})
+	}
+}
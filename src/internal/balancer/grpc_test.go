@@ -0,0 +1,184 @@
+package balancer
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/server"
+	"github.com/pozedorum/load_balancer/pkg/grpcwire"
+	"github.com/pozedorum/load_balancer/pkg/ratelimit"
+)
+
+// h2c-сервер с обработчиком h (HTTP/2 без шифрования, как у gRPC-бэкендов)
+func newH2CServer(t *testing.T, h http.Handler) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(h)
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// gRPC-бэкенд: grpc.health.v1 и сервис test.Echo
+func grpcBackend(w http.ResponseWriter, r *http.Request) {
+	msg, err := grpcwire.ReadFrame(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Path {
+	case "/grpc.health.v1.Health/Check":
+		msg = []byte{1 << 3, 1} // HealthCheckResponse{status: SERVING}
+	case "/test.Echo/Say":
+	case "/test.Echo/Fail":
+		grpcwire.WriteError(w, 5, "no such item") // NOT_FOUND
+		return
+	default:
+		http.NotFound(w, r) // ответ не от gRPC-сервера
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Write(grpcwire.EncodeFrame(msg))
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+}
+
+// балансировщик с одним бэкендом по адресу addr
+func newGRPCBalancer(t *testing.T, addr, health string) *RoundRobinBalancer {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, _ := strconv.Atoi(port)
+	srv, err := server.NewFromConfig(config.ServerConfig{
+		ID:          1,
+		Host:        host,
+		Port:        portNum,
+		Protocol:    server.ProtocolH2C,
+		HealthCheck: health,
+	}, server.NewTransportPool(config.UpstreamConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := ratelimit.NewRateLimiter(time.Minute, time.Minute)
+	t.Cleanup(limiter.Stop)
+	return NewRoundRobinBalancerWithLimiter([]*server.Server{srv}, limiter)
+}
+
+// вызов gRPC через балансировщик, возвращает сообщение ответа и статус
+func callGRPC(t *testing.T, frontURL, method string, msg []byte) ([]byte, grpcwire.Code, string) {
+	t.Helper()
+	client := &http.Client{Transport: &http.Transport{Protocols: new(http.Protocols)}}
+	client.Transport.(*http.Transport).Protocols.SetUnencryptedHTTP2(true)
+
+	req, err := http.NewRequest(http.MethodPost, frontURL+method, bytes.NewReader(grpcwire.EncodeFrame(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("HTTP status = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body) // trailers доступны после чтения тела
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply []byte
+	if len(body) > 0 {
+		if reply, err = grpcwire.ReadFrame(bytes.NewReader(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, message, err := grpcwire.Status(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply, code, message
+}
+
+func TestProxyGRPC(t *testing.T) {
+	backend := newH2CServer(t, http.HandlerFunc(grpcBackend))
+	b := newGRPCBalancer(t, backend.Listener.Addr().String(), server.HealthCheckGRPC)
+	front := newH2CServer(t, b)
+
+	tests := []struct {
+		name    string
+		method  string
+		reply   string
+		code    grpcwire.Code
+		message string
+	}{
+		{"ok", "/test.Echo/Say", "hello", grpcwire.OK, ""},
+		{"grpc error", "/test.Echo/Fail", "", 5, "no such item"},
+		{"http error", "/test.Echo/Missing", "", grpcwire.Unimplemented, "backend returned HTTP 404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, code, message := callGRPC(t, front.URL, tt.method, []byte("hello"))
+			if string(reply) != tt.reply {
+				t.Fatalf("reply = %q, want %q", reply, tt.reply)
+			}
+			if code != tt.code || message != tt.message {
+				t.Fatalf("status = (%d, %q), want (%d, %q)", code, message, tt.code, tt.message)
+			}
+		})
+	}
+}
+
+// ошибки балансировщика передаются клиенту статусом gRPC
+func TestProxyGRPCErrors(t *testing.T) {
+	// бэкенд недоступен: адрес свободного порта
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	t.Run("backend unavailable", func(t *testing.T) {
+		b := newGRPCBalancer(t, addr, server.HealthCheckNone)
+		front := newH2CServer(t, b)
+		_, code, message := callGRPC(t, front.URL, "/test.Echo/Say", nil)
+		if code != grpcwire.Unavailable || message != "backend unavailable" {
+			t.Fatalf("status = (%d, %q)", code, message)
+		}
+	})
+	t.Run("no healthy servers", func(t *testing.T) {
+		b := newGRPCBalancer(t, addr, server.HealthCheckTCP)
+		front := newH2CServer(t, b)
+		_, code, message := callGRPC(t, front.URL, "/test.Echo/Say", nil)
+		if code != grpcwire.Unavailable || message != "No healthy servers available" {
+			t.Fatalf("status = (%d, %q)", code, message)
+		}
+	})
+	t.Run("rate limited", func(t *testing.T) {
+		backend := newH2CServer(t, http.HandlerFunc(grpcBackend))
+		b := newGRPCBalancer(t, backend.Listener.Addr().String(), server.HealthCheckNone)
+		if err := b.RateLimiter().SetLimits("127.0.0.1", config.ClientConfig{Capacity: 1, Rate: 0.001}); err != nil {
+			t.Fatal(err)
+		}
+		front := newH2CServer(t, b)
+		if _, code, _ := callGRPC(t, front.URL, "/test.Echo/Say", nil); code != grpcwire.OK {
+			t.Fatalf("first call status = %d, want OK", code)
+		}
+		_, code, message := callGRPC(t, front.URL, "/test.Echo/Say", nil)
+		if code != grpcwire.ResourceExhausted || message != "Too many requests" {
+			t.Fatalf("status = (%d, %q)", code, message)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package balancer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// заголовок с идентификатором запроса
+const RequestIDHeader = "X-Request-ID"
+
+// максимальная длина идентификатора запроса от клиента
+const maxRequestIDLength = 128
+
+// HeaderPolicy - правила изменения заголовков запроса и ответа маршрута
+type HeaderPolicy struct {
+	request  headerActions
+	response headerActions
+}
+
+// headerActions - действия с заголовками (имена в каноническом виде, порядок фиксирован)
+type headerActions struct {
+	remove []string
+	set    []headerValue
+	add    []headerValue
+}
+
+// headerValue - заголовок и шаблон значения
+type headerValue struct {
+	name  string
+	value string
+}
+
+// NewHeaderPolicy создает правила изменения заголовков
+func NewHeaderPolicy(cfg config.HeaderRules) *HeaderPolicy {
+	return &HeaderPolicy{
+		request:  newHeaderActions(cfg.Request),
+		response: newHeaderActions(cfg.Response),
+	}
+}
+
+func newHeaderActions(cfg config.HeaderActions) headerActions {
+	actions := headerActions{
+		set: newHeaderValues(cfg.Set),
+		add: newHeaderValues(cfg.Add),
+	}
+	for _, name := range cfg.Remove {
+		actions.remove = append(actions.remove, http.CanonicalHeaderKey(name))
+	}
+	return actions
+}
+
+func newHeaderValues(values map[string]string) []headerValue {
+	result := make([]headerValue, 0, len(values))
+	for name, value := range values {
+		result = append(result, headerValue{name: http.CanonicalHeaderKey(name), value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+// apply изменяет заголовки, подставляя в шаблоны сведения о запросе
+func (a *headerActions) apply(h http.Header, info *requestInfo) {
+	for _, name := range a.remove {
+		h.Del(name)
+	}
+	if len(a.set) == 0 && len(a.add) == 0 {
+		return
+	}
+	replacer := info.replacer()
+	for _, hv := range a.set {
+		h.Set(hv.name, replacer.Replace(hv.value))
+	}
+	for _, hv := range a.add {
+		h.Add(hv.name, replacer.Replace(hv.value))
+	}
+}
+
+// requestInfo - сведения о запросе для шаблонов заголовков, хранятся в контексте запроса
+type requestInfo struct {
+	requestID string
+	policy    *HeaderPolicy // правила маршрута (nil - без изменений)
+
+	mu        sync.Mutex
+	clientIP  string
+	backendID int // 0 - сервер ещё не выбран
+}
+
+type requestInfoKey struct{}
+
+// withRequestInfo добавляет в контекст сведения о запросе. Идентификатор запроса
+// берётся из X-Request-ID клиента или генерируется и передаётся бэкенду в том же заголовке.
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		id = newRequestID()
+		r.Header.Set(RequestIDHeader, id)
+	}
+	info := &requestInfo{requestID: id}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+// requestInfoFrom возвращает сведения о запросе из контекста (nil - их нет)
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// withCopiedRequestInfo добавляет в контекст копию сведений о запросе: копия запроса
+// (например, в теневой пул) получает тот же идентификатор и правила маршрута,
+// но выбор своего сервера не меняет сведения основного запроса
+func withCopiedRequestInfo(ctx context.Context) context.Context {
+	info := requestInfoFrom(ctx)
+	if info == nil {
+		return ctx
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{
+		requestID: info.requestID,
+		policy:    info.policy,
+		clientIP:  info.clientIP,
+	})
+}
+
+// случайный идентификатор запроса (16 байт в hex)
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// setClientIP запоминает адрес клиента
+func (info *requestInfo) setClientIP(ip string) {
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.clientIP = ip
+}
+
+// setBackend запоминает выбранный сервер
+func (info *requestInfo) setBackend(id int) {
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.backendID = id
+}
+
+// applyRequest изменяет заголовки запроса к бэкенду по правилам маршрута
+func (info *requestInfo) applyRequest(h http.Header) {
+	if info != nil && info.policy != nil {
+		info.policy.request.apply(h, info)
+	}
+}
+
+// replacer подставляет значения в шаблоны
+func (info *requestInfo) replacer() *strings.Replacer {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	backendID := ""
+	if info.backendID != 0 {
+		backendID = strconv.Itoa(info.backendID)
+	}
+	return strings.NewReplacer(
+		"{client_ip}", info.clientIP,
+		"{request_id}", info.requestID,
+		"{backend_id}", backendID,
+		"{timestamp}", time.Now().UTC().Format(time.RFC3339),
+	)
+}
+
+// headerWriter изменяет заголовки ответа по правилам маршрута перед отправкой клиенту
+type headerWriter struct {
+	http.ResponseWriter
+	info        *requestInfo
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= 200 {
+		w.wroteHeader = true
+		w.info.policy.response.apply(w.Header(), w.info)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,91 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// копия запроса в теневой пул получает тот же X-Request-ID и заголовки по правилам маршрута
+func TestMirrorKeepsRequestInfo(t *testing.T) {
+	primaryHeaders := make(chan http.Header, 1)
+	shadowHeaders := make(chan http.Header, 1)
+	pool := newTestPool(t, recordHeaders(primaryHeaders))
+	shadow := newTestPool(t, recordHeaders(shadowHeaders))
+	if err := pool.SetMirror("shadow", shadow, config.MirrorConfig{Percent: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := NewRouter([]config.RouteConfig{{
+		Path: "/",
+		Pool: DefaultPool,
+		Headers: &config.HeaderRules{Request: config.HeaderActions{
+			Set:    map[string]string{"X-Trace": "trace-{request_id}", "X-Client": "{client_ip}"},
+			Remove: []string{"X-Internal"},
+		}},
+	}}, "", map[string]*RoundRobinBalancer{DefaultPool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/process", nil)
+	req.Header.Set("X-Internal", "secret")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", rec.Code)
+	}
+	id := rec.Header().Get(RequestIDHeader)
+	if id == "" {
+		t.Fatal("X-Request-ID is not set in the response")
+	}
+
+	for name, ch := range map[string]chan http.Header{"primary": primaryHeaders, "shadow": shadowHeaders} {
+		h := waitHeaders(t, ch)
+		if got := h.Get(RequestIDHeader); got != id {
+			t.Errorf("%s: X-Request-ID = %q, want %q", name, got, id)
+		}
+		if got := h.Get("X-Trace"); got != "trace-"+id {
+			t.Errorf("%s: X-Trace = %q, want %q", name, got, "trace-"+id)
+		}
+		if got := h.Get("X-Client"); got != "192.0.2.1" {
+			t.Errorf("%s: X-Client = %q, want 192.0.2.1", name, got)
+		}
+		if h.Get("X-Internal") != "" {
+			t.Errorf("%s: X-Internal is not removed", name)
+		}
+	}
+}
+
+// идентификатор запроса клиента сохраняется, слишком длинный заменяется новым
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		keep bool
+	}{
+		{"generated", "", false},
+		{"from client", "client-id-1", true},
+		{"too long", string(make([]byte, maxRequestIDLength+1)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.id != "" {
+				req.Header.Set(RequestIDHeader, tt.id)
+			}
+			req, info := withRequestInfo(req)
+			if info.requestID == "" || req.Header.Get(RequestIDHeader) != info.requestID {
+				t.Fatalf("request id = %q, header = %q", info.requestID, req.Header.Get(RequestIDHeader))
+			}
+			if (info.requestID == tt.id) != tt.keep {
+				t.Fatalf("request id = %q, keep client id = %v", info.requestID, tt.keep)
+			}
+			if requestInfoFrom(req.Context()) != info {
+				t.Fatal("request info is not stored in the context")
+			}
+		})
+	}
+}
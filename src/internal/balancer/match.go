@@ -0,0 +1,162 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// Matcher проверяет запрос по методу, пути, заголовкам, параметрам и cookie.
+// Заданные условия объединяются через AND, вложенные any - через OR.
+type Matcher struct {
+	methods   []string
+	pathRegex *regexp.Regexp
+	headers   []valueMatcher
+	query     []valueMatcher
+	cookies   []valueMatcher
+	all       []*Matcher
+	any       []*Matcher
+}
+
+// valueMatcher проверяет значение заголовка, параметра или cookie
+type valueMatcher struct {
+	name    string
+	present bool           // достаточно наличия ("*")
+	regex   *regexp.Regexp // регулярное выражение ("~regex")
+	value   string         // точное значение
+}
+
+// NewMatcher создает Matcher по настройкам, регулярные выражения проверяются сразу
+func NewMatcher(cfg config.MatchConfig) (*Matcher, error) {
+	m := &Matcher{}
+	for _, method := range cfg.Methods {
+		m.methods = append(m.methods, strings.ToUpper(method))
+	}
+	if cfg.PathRegex != "" {
+		re, err := regexp.Compile(cfg.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path_regex: %w", err)
+		}
+		m.pathRegex = re
+	}
+
+	var err error
+	if m.headers, err = newValueMatchers(cfg.Headers, http.CanonicalHeaderKey); err != nil {
+		return nil, fmt.Errorf("header %w", err)
+	}
+	if m.query, err = newValueMatchers(cfg.Query, nil); err != nil {
+		return nil, fmt.Errorf("query %w", err)
+	}
+	if m.cookies, err = newValueMatchers(cfg.Cookies, nil); err != nil {
+		return nil, fmt.Errorf("cookie %w", err)
+	}
+
+	for _, nested := range cfg.All {
+		matcher, err := NewMatcher(nested)
+		if err != nil {
+			return nil, err
+		}
+		m.all = append(m.all, matcher)
+	}
+	for _, nested := range cfg.Any {
+		matcher, err := NewMatcher(nested)
+		if err != nil {
+			return nil, err
+		}
+		m.any = append(m.any, matcher)
+	}
+	return m, nil
+}
+
+// newValueMatchers разбирает условия на значения, canonical приводит имя к каноническому виду
+func newValueMatchers(values map[string]string, canonical func(string) string) ([]valueMatcher, error) {
+	matchers := make([]valueMatcher, 0, len(values))
+	for name, value := range values {
+		if canonical != nil {
+			name = canonical(name)
+		}
+		vm := valueMatcher{name: name}
+		switch {
+		case value == "*":
+			vm.present = true
+		case strings.HasPrefix(value, "~"):
+			re, err := regexp.Compile(value[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid regex: %w", name, err)
+			}
+			vm.regex = re
+		default:
+			vm.value = value
+		}
+		matchers = append(matchers, vm)
+	}
+	// порядок проверки не зависит от порядка обхода map
+	sort.Slice(matchers, func(i, j int) bool { return matchers[i].name < matchers[j].name })
+	return matchers, nil
+}
+
+// Match проверяет запрос, nil Matcher подходит для любого запроса
+func (m *Matcher) Match(r *http.Request) bool {
+	if m == nil {
+		return true
+	}
+	if len(m.methods) > 0 && !slices.Contains(m.methods, r.Method) {
+		return false
+	}
+	if m.pathRegex != nil && !m.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	for _, vm := range m.headers {
+		if !vm.match(r.Header.Values(vm.name)) {
+			return false
+		}
+	}
+	if len(m.query) > 0 {
+		query := r.URL.Query()
+		for _, vm := range m.query {
+			if !vm.match(query[vm.name]) {
+				return false
+			}
+		}
+	}
+	for _, vm := range m.cookies {
+		var values []string
+		for _, cookie := range r.CookiesNamed(vm.name) {
+			values = append(values, cookie.Value)
+		}
+		if !vm.match(values) {
+			return false
+		}
+	}
+	for _, nested := range m.all {
+		if !nested.Match(r) {
+			return false
+		}
+	}
+	if len(m.any) > 0 {
+		return slices.ContainsFunc(m.any, func(nested *Matcher) bool { return nested.Match(r) })
+	}
+	return true
+}
+
+// проверка значений: подходит, если подходит хотя бы одно из них
+func (vm *valueMatcher) match(values []string) bool {
+	for _, value := range values {
+		switch {
+		case vm.present:
+			return true
+		case vm.regex != nil:
+			if vm.regex.MatchString(value) {
+				return true
+			}
+		case value == vm.value:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.MatchConfig
+		setup func(r *http.Request)
+		want  bool
+	}{
+		{"empty", config.MatchConfig{}, nil, true},
+		{"method", config.MatchConfig{Methods: []string{"post"}}, nil, true},
+		{"other method", config.MatchConfig{Methods: []string{"GET", "PUT"}}, nil, false},
+		{"path regex", config.MatchConfig{PathRegex: `^/api/v\d+/`}, nil, true},
+		{"path regex mismatch", config.MatchConfig{PathRegex: `^/admin`}, nil, false},
+		{"header exact", config.MatchConfig{Headers: map[string]string{"x-env": "beta"}},
+			func(r *http.Request) { r.Header.Set("X-Env", "beta") }, true},
+		{"header exact mismatch", config.MatchConfig{Headers: map[string]string{"X-Env": "beta"}},
+			func(r *http.Request) { r.Header.Set("X-Env", "prod") }, false},
+		{"header present", config.MatchConfig{Headers: map[string]string{"X-Env": "*"}},
+			func(r *http.Request) { r.Header.Set("X-Env", "any") }, true},
+		{"header missing", config.MatchConfig{Headers: map[string]string{"X-Env": "*"}}, nil, false},
+		{"header regex on any value", config.MatchConfig{Headers: map[string]string{"X-Env": "~^be"}},
+			func(r *http.Request) { r.Header.Add("X-Env", "prod"); r.Header.Add("X-Env", "beta") }, true},
+		{"query", config.MatchConfig{Query: map[string]string{"version": "2"}}, nil, true},
+		{"query mismatch", config.MatchConfig{Query: map[string]string{"version": "3"}}, nil, false},
+		{"cookie", config.MatchConfig{Cookies: map[string]string{"group": "~^(a|b)$"}},
+			func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "group", Value: "b"}) }, true},
+		{"cookie missing", config.MatchConfig{Cookies: map[string]string{"group": "*"}}, nil, false},
+		{"all", config.MatchConfig{All: []config.MatchConfig{{Methods: []string{"POST"}}, {Query: map[string]string{"version": "2"}}}}, nil, true},
+		{"all one fails", config.MatchConfig{All: []config.MatchConfig{{Methods: []string{"POST"}}, {Methods: []string{"GET"}}}}, nil, false},
+		{"any", config.MatchConfig{Any: []config.MatchConfig{{Methods: []string{"GET"}}, {Query: map[string]string{"version": "2"}}}}, nil, true},
+		{"any none", config.MatchConfig{Any: []config.MatchConfig{{Methods: []string{"GET"}}, {Methods: []string{"PUT"}}}}, nil, false},
+		{"and with any", config.MatchConfig{Methods: []string{"GET"}, Any: []config.MatchConfig{{Query: map[string]string{"version": "2"}}}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/api/v2/items?version=2", nil)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			if got := m.Match(r); got != tt.want {
+				t.Fatalf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMatcherInvalidRegex(t *testing.T) {
+	for _, cfg := range []config.MatchConfig{
+		{PathRegex: "("},
+		{Headers: map[string]string{"X-Env": "~("}},
+		{Any: []config.MatchConfig{{Query: map[string]string{"v": "~["}}}},
+	} {
+		if _, err := NewMatcher(cfg); err == nil {
+			t.Errorf("NewMatcher(%+v) accepted invalid regex", cfg)
+		}
+	}
+}
+
+// routeFor возвращает пул маршрута, выбранного для запроса ("" - пул по умолчанию)
+func routeFor(rt *Router, r *http.Request) string {
+	host := requestHost(r)
+	for _, route := range rt.routes {
+		if route.match(host, r) {
+			return route.pool
+		}
+	}
+	return ""
+}
+
+func TestRouter(t *testing.T) {
+	pools := map[string]*RoundRobinBalancer{DefaultPool: {}, "api": {}, "beta": {}, "wild": {}}
+	rt, err := NewRouter([]config.RouteConfig{
+		{Path: "/api", Pool: "api"},
+		{Path: "/api", Pool: "beta", Priority: 10, Match: &config.MatchConfig{Headers: map[string]string{"X-Env": "beta"}}},
+		{Hosts: []string{"*.Example.com"}, Pool: "wild"},
+	}, "", pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		host   string
+		path   string
+		header string
+		want   string
+	}{
+		{"path prefix", "lb.local", "/api/items", "", "api"},
+		{"higher priority with condition", "lb.local", "/api/items", "beta", "beta"},
+		{"declaration order", "www.example.com", "/api", "", "api"},
+		{"wildcard host with port", "WWW.example.com:8080", "/", "", "wild"},
+		{"wildcard does not match apex", "example.com", "/", "", ""},
+		{"fallback", "lb.local", "/other", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Host = tt.host
+			if tt.header != "" {
+				r.Header.Set("X-Env", tt.header)
+			}
+			if got := routeFor(rt, r); got != tt.want {
+				t.Fatalf("pool = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	pools := map[string]*RoundRobinBalancer{DefaultPool: {}}
+	tests := []struct {
+		name     string
+		routes   []config.RouteConfig
+		fallback string
+	}{
+		{"unknown route pool", []config.RouteConfig{{Pool: "missing"}}, ""},
+		{"unknown fallback pool", nil, "missing"},
+		{"invalid match", []config.RouteConfig{{Pool: DefaultPool, Match: &config.MatchConfig{PathRegex: "("}}}, ""},
+		{"unknown server", []config.RouteConfig{{Pool: DefaultPool, Servers: []int{7}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRouter(tt.routes, tt.fallback, pools); err == nil {
+				t.Fatal("invalid routes are accepted")
+			}
+		})
+	}
+	if _, err := NewRouter(nil, "", map[string]*RoundRobinBalancer{"api": {}}); err == nil {
+		t.Fatal("router without default pool is accepted")
+	}
+}
@@ -0,0 +1,236 @@
+package balancer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/pkg/grpcwire"
+)
+
+// значения по умолчанию для копирования запросов
+const (
+	defaultMirrorInFlight = 100
+	defaultMirrorBodySize = 1 << 20
+	defaultMirrorTimeout  = 10 * time.Second
+)
+
+// заголовок, которым помечаются копии запросов
+const MirrorHeader = "X-Mirrored-Request"
+
+// Mirror копирует часть запросов пула в теневой пул без ожидания ответа (fire-and-forget).
+// Ответы теневого пула отбрасываются, учитываются только метрики.
+type Mirror struct {
+	name        string              // название теневого пула
+	target      *RoundRobinBalancer // теневой пул
+	percent     float64
+	maxBodySize int64
+	timeout     time.Duration
+	slots       chan struct{} // ограничение одновременных копий
+
+	mu        sync.Mutex
+	requests  int64         // отправлено копий
+	errors    int64         // ошибок соединения и ответов 5xx
+	dropped   int64         // копий, отброшенных из-за лимита или размера тела
+	latency   time.Duration // суммарное время ответов теневого пула
+	completed int64         // копий, на которые пришёл ответ
+	statuses  map[int]int64 // количество ответов по кодам
+}
+
+// MirrorStats - метрики копирования для admin API
+type MirrorStats struct {
+	Pool       string           `json:"pool"`
+	Percent    float64          `json:"percent"`
+	Requests   int64            `json:"requests"`
+	Completed  int64            `json:"completed"`
+	Errors     int64            `json:"errors"`
+	Dropped    int64            `json:"dropped"`
+	AvgLatency config.Duration  `json:"avg_latency"`
+	Statuses   map[string]int64 `json:"statuses"`
+}
+
+// SetMirror включает копирование запросов пула в теневой пул
+func (b *RoundRobinBalancer) SetMirror(name string, target *RoundRobinBalancer, cfg config.MirrorConfig) error {
+	if target == b {
+		return errors.New("mirror pool must differ from the pool")
+	}
+	if cfg.Percent < 0 || cfg.Percent > 100 {
+		return errors.New("mirror percent must be between 0 and 100")
+	}
+	m := &Mirror{
+		name:        name,
+		target:      target,
+		percent:     cfg.Percent,
+		maxBodySize: cfg.MaxBodySize,
+		timeout:     cfg.Timeout.Duration,
+		statuses:    make(map[int]int64),
+	}
+	if m.maxBodySize <= 0 {
+		m.maxBodySize = defaultMirrorBodySize
+	}
+	if m.timeout <= 0 {
+		m.timeout = defaultMirrorTimeout
+	}
+	inFlight := cfg.MaxInFlight
+	if inFlight <= 0 {
+		inFlight = defaultMirrorInFlight
+	}
+	m.slots = make(chan struct{}, inFlight)
+	b.mirror = m
+	// при разделении запросов копии отправляют группы, после проверок лимитов
+	if b.canary != nil {
+		b.canary.stable.mirror, b.canary.canary.mirror = m, m
+	}
+	return nil
+}
+
+// Mirror возвращает копирование запросов пула (nil - выключено)
+func (b *RoundRobinBalancer) Mirror() *Mirror {
+	return b.mirror
+}
+
+// Copy отправляет копию части запросов в теневой пул. Тело запроса читается в память
+// и подставляется обратно, поэтому основной запрос не меняется. WebSocket и gRPC не копируются.
+func (m *Mirror) Copy(r *http.Request) {
+	if rand.Float64()*100 >= m.percent || isUpgrade(r) || grpcwire.IsGRPC(r) {
+		return
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, m.maxBodySize+1))
+		r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		if err != nil || int64(len(body)) > m.maxBodySize {
+			m.drop()
+			return
+		}
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		m.drop()
+		return
+	}
+
+	// копия не отменяется вместе с запросом клиента, но сохраняет его сведения (X-Request-ID, правила маршрута)
+	ctx, cancel := context.WithTimeout(withCopiedRequestInfo(context.WithoutCancel(r.Context())), m.timeout)
+	req := r.Clone(ctx)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set(MirrorHeader, "true")
+
+	m.mu.Lock()
+	m.requests++
+	m.mu.Unlock()
+	go func() {
+		defer cancel()
+		defer func() { <-m.slots }()
+		m.send(req)
+	}()
+}
+
+// отправка копии на здоровый сервер теневого пула, ответ отбрасывается
+func (m *Mirror) send(req *http.Request) {
+	server, err := m.target.findHealthyServer()
+	if err != nil {
+		m.record(0, 0, true)
+		return
+	}
+	execTime := req.Header.Get("Execution-Time")
+	if execTime == "" {
+		execTime = "0"
+	}
+	proxy, err := m.target.newProxy(server, func(pr *httputil.ProxyRequest) {
+		pr.Out.URL.Path = "/process"
+		pr.Out.Header.Set("Execution-Time", execTime)
+	})
+	if err != nil {
+		m.record(0, 0, true)
+		return
+	}
+	failed := false
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Mirror error (pool %s, server %d): %v", m.name, server.ID, err)
+		failed = true
+	}
+	defer server.TrackConn()()
+
+	discard := &discardWriter{header: make(http.Header), code: http.StatusOK}
+	start := time.Now()
+	proxy.ServeHTTP(discard, req)
+	if failed {
+		m.record(0, 0, true)
+		return
+	}
+	m.record(discard.code, time.Since(start), discard.code >= 500)
+}
+
+// учёт результата копии, code=0 - ответа не было
+func (m *Mirror) record(code int, latency time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if failed {
+		m.errors++
+	}
+	if code != 0 {
+		m.completed++
+		m.latency += latency
+		m.statuses[code]++
+	}
+}
+
+// учёт отброшенной копии
+func (m *Mirror) drop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped++
+}
+
+// Stats возвращает метрики копирования
+func (m *Mirror) Stats() MirrorStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := MirrorStats{
+		Pool:      m.name,
+		Percent:   m.percent,
+		Requests:  m.requests,
+		Completed: m.completed,
+		Errors:    m.errors,
+		Dropped:   m.dropped,
+		Statuses:  make(map[string]int64, len(m.statuses)),
+	}
+	if m.completed > 0 {
+		stats.AvgLatency = config.Duration{Duration: m.latency / time.Duration(m.completed)}
+	}
+	for code, count := range m.statuses {
+		stats.Statuses[strconv.Itoa(code)] = count
+	}
+	return stats
+}
+
+// readCloser - тело запроса, часть которого уже прочитана в память
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// discardWriter отбрасывает ответ, запоминая только код
+type discardWriter struct {
+	header http.Header
+	code   int
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardWriter) WriteHeader(code int)        { w.code = code }
@@ -0,0 +1,95 @@
+package balancer
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/pkg/realip"
+)
+
+// Priority - класс приоритета запроса, при перегрузке первыми отклоняются запросы с низким приоритетом
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	PriorityCritical
+)
+
+// заголовок приоритета по умолчанию
+const DefaultPriorityHeader = "X-Priority"
+
+var priorityNames = map[string]Priority{
+	"low":      PriorityLow,
+	"normal":   PriorityNormal,
+	"high":     PriorityHigh,
+	"critical": PriorityCritical,
+}
+
+// ParsePriority разбирает название приоритета (low, normal, high, critical) или его номер (0-3)
+func ParsePriority(s string) (Priority, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if p, ok := priorityNames[s]; ok {
+		return p, true
+	}
+	if len(s) == 1 && s[0] >= '0' && s[0] <= byte('0'+PriorityCritical) {
+		return Priority(s[0] - '0'), true
+	}
+	return PriorityNormal, false
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// PriorityResolver определяет приоритет запроса: сначала по маршруту, затем по заголовку.
+// Заголовок учитывается только от доверенных прокси, иначе любой клиент мог бы
+// выставить себе critical и обойти сброс нагрузки и очередь.
+type PriorityResolver struct {
+	header  string                 // заголовок с приоритетом
+	routes  []config.PriorityRoute // приоритеты по префиксу пути
+	proxies *realip.Resolver       // доверенные прокси, от которых принимается заголовок
+}
+
+// NewPriorityResolver создает PriorityResolver по настройкам
+func NewPriorityResolver(cfg config.PriorityConfig, proxies *realip.Resolver) *PriorityResolver {
+	header := cfg.Header
+	if header == "" {
+		header = DefaultPriorityHeader
+	}
+	return &PriorityResolver{header: header, routes: cfg.Routes, proxies: proxies}
+}
+
+// Resolve возвращает приоритет запроса, по умолчанию normal
+func (pr *PriorityResolver) Resolve(r *http.Request) Priority {
+	if pr == nil {
+		return PriorityNormal
+	}
+	for _, route := range pr.routes {
+		if strings.HasPrefix(r.URL.Path, route.Path) {
+			if p, ok := ParsePriority(route.Priority); ok {
+				return p
+			}
+		}
+	}
+	if !pr.proxies.FromTrustedProxy(r) {
+		return PriorityNormal
+	}
+	if p, ok := ParsePriority(r.Header.Get(pr.header)); ok {
+		return p
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,151 @@
+package balancer
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+var ErrQueueFull = errors.New("request queue is full")
+
+// Job - запрос, ожидающий отправки на бэкенд
+type Job struct {
+	Priority Priority // класс приоритета
+	Tenant   string   // клиент (ключ rate limiter), между клиентами очередь справедливая
+	Cost     int      // стоимость запроса (вес в справедливой очереди)
+	Run      func()   // отправка запроса, выполняется синхронно в обработчике очереди
+
+	start, finish float64 // виртуальные метки начала и окончания (WFQ)
+}
+
+// очередь одного клиента внутри класса приоритета
+type tenantQueue struct {
+	jobs       []*Job
+	lastFinish float64 // виртуальное время окончания последнего запроса клиента
+}
+
+// очередь одного класса приоритета
+type priorityClass struct {
+	tenants     map[string]*tenantQueue
+	virtualTime float64 // виртуальное время класса (метка начала последнего отправленного запроса)
+}
+
+// Scheduler - очередь запросов к бэкендам с приоритетами и взвешенной справедливой очередью (WFQ).
+// Запросы более высокого приоритета всегда отправляются первыми, внутри приоритета
+// клиенты обслуживаются пропорционально весам, поэтому один шумный клиент
+// не может вытеснить остальных. Количество одновременно отправляемых запросов
+// ограничено числом обработчиков.
+type Scheduler struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	classes   [PriorityCritical + 1]*priorityClass
+	weights   map[string]float64 // веса клиентов (по умолчанию 1)
+	queued    int                // запросов в очереди
+	maxQueued int                // максимальный размер очереди
+}
+
+// NewScheduler создает очередь и запускает cfg.Workers обработчиков (не меньше одного),
+// число обработчиков по количеству бэкендов подставляет RoundRobinBalancer.EnableQueue
+func NewScheduler(cfg config.QueueConfig) *Scheduler {
+	s := &Scheduler{
+		weights:   cfg.Weights,
+		maxQueued: cfg.MaxQueued,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i := range s.classes {
+		s.classes[i] = &priorityClass{tenants: make(map[string]*tenantQueue)}
+	}
+	for range max(cfg.Workers, 1) {
+		go s.worker()
+	}
+	return s
+}
+
+// EnableQueue создает очередь запросов по настройкам, при workers = 0 обработчиков
+// столько же, сколько серверов в пуле (бэкенд обрабатывает задачи по одной)
+func (b *RoundRobinBalancer) EnableQueue(cfg config.QueueConfig) {
+	if cfg.Workers == 0 {
+		cfg.Workers = len(b.servers)
+	}
+	b.SetQueue(NewScheduler(cfg))
+}
+
+// Enqueue ставит запрос в очередь, ErrQueueFull если очередь заполнена
+func (s *Scheduler) Enqueue(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxQueued > 0 && s.queued >= s.maxQueued {
+		return ErrQueueFull
+	}
+
+	class := s.classes[job.Priority]
+	tenant, ok := class.tenants[job.Tenant]
+	if !ok {
+		tenant = &tenantQueue{}
+		class.tenants[job.Tenant] = tenant
+	}
+	weight := s.weights[job.Tenant]
+	if weight <= 0 {
+		weight = 1
+	}
+	job.start = max(class.virtualTime, tenant.lastFinish)
+	job.finish = job.start + float64(max(job.Cost, 1))/weight
+	tenant.lastFinish = job.finish
+	tenant.jobs = append(tenant.jobs, job)
+
+	s.queued++
+	s.cond.Signal()
+	return nil
+}
+
+// Len возвращает количество запросов в очереди
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queued
+}
+
+// worker забирает запросы из очереди и выполняет их по одному
+func (s *Scheduler) worker() {
+	for {
+		s.mu.Lock()
+		for s.queued == 0 {
+			s.cond.Wait()
+		}
+		job := s.next()
+		s.mu.Unlock()
+
+		job.Run()
+	}
+}
+
+// next выбирает следующий запрос: старший непустой приоритет,
+// внутри него - запрос с наименьшей виртуальной меткой окончания. Вызывается под мьютексом.
+func (s *Scheduler) next() *Job {
+	for p := len(s.classes) - 1; p >= 0; p-- {
+		class := s.classes[p]
+		var best *tenantQueue
+		for _, tenant := range class.tenants {
+			if len(tenant.jobs) > 0 && (best == nil || tenant.jobs[0].finish < best.jobs[0].finish) {
+				best = tenant
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		job := best.jobs[0]
+		best.jobs = best.jobs[1:]
+		class.virtualTime = job.start
+		s.queued--
+		// клиенты без запросов, чьё время уже прошло, больше не влияют на метки
+		for name, tenant := range class.tenants {
+			if len(tenant.jobs) == 0 && tenant.lastFinish <= class.virtualTime {
+				delete(class.tenants, name)
+			}
+		}
+		return job
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// blockQueue занимает единственный обработчик очереди, пока не закрыт возвращённый канал
+func blockQueue(t *testing.T, s *Scheduler) chan struct{} {
+	t.Helper()
+	started, release := make(chan struct{}), make(chan struct{})
+	err := s.Enqueue(&Job{Priority: PriorityCritical, Tenant: "blocker", Run: func() {
+		close(started)
+		<-release
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	return release
+}
+
+// runOrder ставит запросы в очередь занятого обработчика и возвращает порядок их выполнения
+func runOrder(t *testing.T, s *Scheduler, jobs []*Job) []string {
+	t.Helper()
+	release := blockQueue(t, s)
+	done := make(chan string, len(jobs))
+	for _, job := range jobs {
+		job.Run = func() { done <- job.Tenant }
+		if err := s.Enqueue(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(release)
+
+	order := make([]string, 0, len(jobs))
+	for range jobs {
+		select {
+		case tenant := <-done:
+			order = append(order, tenant)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("queue is stuck after %v", order)
+		}
+	}
+	return order
+}
+
+func TestSchedulerPriorities(t *testing.T) {
+	s := NewScheduler(config.QueueConfig{Workers: 1})
+	order := runOrder(t, s, []*Job{
+		{Priority: PriorityLow, Tenant: "low"},
+		{Priority: PriorityNormal, Tenant: "normal"},
+		{Priority: PriorityCritical, Tenant: "critical"},
+		{Priority: PriorityHigh, Tenant: "high"},
+		{Priority: PriorityNormal, Tenant: "normal"},
+	})
+	want := []string{"critical", "high", "normal", "normal", "low"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
+
+// клиенты одного приоритета обслуживаются пропорционально весам
+func TestSchedulerWeightedFair(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		costs   map[string]int
+		first   int // сколько первых запросов проверяется
+		wantA   int // сколько из них у клиента a
+	}{
+		{"equal weights", nil, nil, 4, 2},
+		{"double weight", map[string]float64{"a": 2}, nil, 6, 4},
+		{"double cost", nil, map[string]int{"b": 2}, 6, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(config.QueueConfig{Workers: 1, Weights: tt.weights})
+			// шумный клиент a ставит все запросы раньше клиента b
+			var jobs []*Job
+			for _, tenant := range []string{"a", "b"} {
+				for range 8 {
+					jobs = append(jobs, &Job{Priority: PriorityNormal, Tenant: tenant, Cost: tt.costs[tenant]})
+				}
+			}
+			order := runOrder(t, s, jobs)
+			countA := 0
+			for _, tenant := range order[:tt.first] {
+				if tenant == "a" {
+					countA++
+				}
+			}
+			if countA != tt.wantA {
+				t.Fatalf("a served %d of first %d, want %d (order %v)", countA, tt.first, tt.wantA, order)
+			}
+		})
+	}
+}
+
+func TestSchedulerFull(t *testing.T) {
+	s := NewScheduler(config.QueueConfig{Workers: 1, MaxQueued: 2})
+	release := blockQueue(t, s)
+	defer close(release)
+
+	for range 2 {
+		if err := s.Enqueue(&Job{Tenant: "a", Run: func() {}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Enqueue(&Job{Tenant: "b", Run: func() {}}); err != ErrQueueFull {
+		t.Fatalf("err = %v, want ErrQueueFull", err)
+	}
+	if n := s.Len(); n != 2 {
+		t.Fatalf("Len = %d, want 2", n)
+	}
+}
+
+// при workers = 0 обработчиков столько же, сколько серверов пула
+func TestEnableQueueWorkers(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	defer close(release)
+
+	pool := newTestPool(t, nil, nil, nil)
+	pool.EnableQueue(config.QueueConfig{})
+	for range 3 {
+		pool.queue.Enqueue(&Job{Tenant: "a", Run: func() {
+			started <- struct{}{}
+			<-release
+		}})
+	}
+	for range 3 {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("queue runs fewer workers than servers in the pool")
+		}
+	}
+}
@@ -8,12 +8,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
-	"strings"
-	"sync"
+	"net/url"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/pozedorum/load_balancer/internal/server"
+	"github.com/pozedorum/load_balancer/pkg/grpcwire"
 	"github.com/pozedorum/load_balancer/pkg/ratelimit"
+	"github.com/pozedorum/load_balancer/pkg/realip"
 )
 
 var (
@@ -25,27 +28,82 @@ var (
 type RoundRobinBalancer struct {
 	servers     []*server.Server       // список серверов
 	rateLimiter *ratelimit.RateLimiter // ограничитель количества запросов
-	lock        sync.Mutex             // мьютекс блокировки данных
-	current     int                    // текущий сервер выбранный для отправки запроса
+	resolver    *realip.Resolver       // определение адреса клиента за доверенными прокси
+	priorities  *PriorityResolver      // определение приоритета запроса
+	shedder     *Shedder               // адаптивный сброс нагрузки (nil - выключен)
+	queue       *Scheduler             // очередь запросов с приоритетами (nil - отправка сразу)
+	strategy    Strategy               // стратегия выбора сервера
+	idleTimeout time.Duration          // таймаут простоя соединений после смены протокола (0 - без таймаута)
+	canary      *Canary                // разделение запросов с канареечной группой (nil - выключено)
+	observe     func(failed bool)      // учёт результатов запросов (канареечная группа)
+	mirror      *Mirror                // копирование запросов в теневой пул (nil - выключено)
 }
 
-// конструктор балансировщика
+// конструктор балансировщика с лимитами из config/rate_limits.json
 func NewRoundRobinBalancer(servers []*server.Server) *RoundRobinBalancer {
+	return NewRoundRobinBalancerWithLimiter(servers, ratelimit.NewRateLimiterWithConfig(5*time.Minute, 5*time.Minute))
+}
+
+// конструктор балансировщика со своим ограничителем запросов (например, для отдельного пула)
+func NewRoundRobinBalancerWithLimiter(servers []*server.Server, rateLimiter *ratelimit.RateLimiter) *RoundRobinBalancer {
 	balancer := &RoundRobinBalancer{
 		servers:     servers,
-		rateLimiter: ratelimit.NewRateLimiterWithConfig(5*time.Minute, 5*time.Minute),
+		rateLimiter: rateLimiter,
+		strategy:    &RoundRobin{},
 	}
 	go balancer.StartHealthCheck()
 	return balancer
 }
 
+// ограничитель запросов балансировщика (для admin API)
+func (b *RoundRobinBalancer) RateLimiter() *ratelimit.RateLimiter {
+	return b.rateLimiter
+}
+
+// установка доверенных прокси для определения адреса клиента
+// (используется и для ключа rate limiting, и для заголовков X-Forwarded-*)
+func (b *RoundRobinBalancer) SetResolver(resolver *realip.Resolver) {
+	b.resolver = resolver
+	b.rateLimiter.SetClientIPFunc(resolver.ClientIP)
+}
+
+// установка правил определения приоритета запросов
+func (b *RoundRobinBalancer) SetPriorities(priorities *PriorityResolver) {
+	b.priorities = priorities
+}
+
+// установка адаптивного сброса нагрузки
+func (b *RoundRobinBalancer) SetShedder(shedder *Shedder) {
+	b.shedder = shedder
+}
+
+// установка очереди запросов с приоритетами
+func (b *RoundRobinBalancer) SetQueue(queue *Scheduler) {
+	b.queue = queue
+}
+
+// установка стратегии выбора сервера
+func (b *RoundRobinBalancer) SetStrategy(strategy Strategy) {
+	b.strategy = strategy
+}
+
+// установка таймаута простоя для WebSocket и других соединений со сменой протокола
+func (b *RoundRobinBalancer) SetUpgradeIdleTimeout(timeout time.Duration) {
+	b.idleTimeout = timeout
+}
+
 // функция автоматической проверки состояния серверов
 func (b *RoundRobinBalancer) StartHealthCheck() {
+	startHealthCheck(b.servers)
+}
+
+// периодическая проверка состояния серверов (каждые 5 секунд)
+func startHealthCheck(servers []*server.Server) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		for _, s := range b.servers {
+		for _, s := range servers {
 			go s.CheckHealth()
 		}
 	}
@@ -53,92 +111,418 @@ func (b *RoundRobinBalancer) StartHealthCheck() {
 
 // функция получения сервера из списка серверов
 func (b *RoundRobinBalancer) GetNextServer() (*server.Server, error) {
-	b.lock.Lock()
-	defer b.lock.Unlock()
-
-	for i := 0; i < len(b.servers); i++ {
-		server := b.servers[b.current]
+	return b.strategy.Next(b.servers)
+}
 
-		if server.Healthy {
-			b.current = (b.current + 1) % len(b.servers)
-			return server, nil
+// Subset возвращает балансировщик на части серверов пула (по ID): ограничитель запросов,
+// сброс нагрузки, очередь и состояние серверов общие с пулом, очередность выбора - своя
+func (b *RoundRobinBalancer) Subset(ids []int) (*RoundRobinBalancer, error) {
+	servers := make([]*server.Server, 0, len(ids))
+	for _, id := range ids {
+		i := slices.IndexFunc(b.servers, func(s *server.Server) bool { return s.ID == id })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown server %d", id)
 		}
+		servers = append(servers, b.servers[i])
 	}
+	subset := *b
+	subset.servers = servers
+	subset.strategy = newStrategyLike(b.strategy)
+	subset.canary = nil
+	subset.observe = nil
+	return &subset, nil
+}
 
-	return nil, ErrNoHealthyServers
+// ServeHTTP позволяет использовать балансировщик как http.Handler (например, в Router)
+func (b *RoundRobinBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.HandleRequest(w, r)
 }
 
 // обработка запроса балансировщиком
 func (b *RoundRobinBalancer) HandleRequest(w http.ResponseWriter, r *http.Request) {
-	clientIP := strings.Split(r.RemoteAddr, ":")[0]
-	if !b.rateLimiter.TakeToken(clientIP) {
-		log.Printf("request from %s is canceled", clientIP)
-		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+	if b.canary != nil {
+		b.canary.ServeHTTP(w, r)
+		return
+	}
+	info := requestInfoFrom(r.Context())
+	clientIP := b.resolver.ClientIP(r)
+	info.setClientIP(clientIP)
+	if !b.rateLimiter.Allowed(clientIP) {
+		log.Printf("request from %s is denied by access list", clientIP)
+		writeError(w, r, "Forbidden", http.StatusForbidden)
+		return
+	}
+	clientKey := b.rateLimiter.Key(r)
+	cost := b.rateLimiter.Cost(r)
+	allowed := b.rateLimiter.TakeTokens(clientKey, cost)
+	state, _ := b.rateLimiter.State(clientKey, cost)
+	state.WriteHeaders(w.Header())
+	if !allowed {
+		log.Printf("request from %s is canceled (cost %d)", clientKey, cost)
+		state.WriteRetryAfter(w.Header())
+		writeError(w, r, "Too many requests", http.StatusTooManyRequests)
+		return
+	}
+	release, ok := b.rateLimiter.Acquire(clientKey)
+	if !ok {
+		log.Printf("request from %s is canceled: too many requests in flight", clientKey)
+		b.rateLimiter.ReturnTokens(clientKey, cost)
+		// токены возвращены: заголовки лимита показывают состояние после возврата
+		state, _ = b.rateLimiter.State(clientKey, cost)
+		state.WriteHeaders(w.Header())
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, "Too many concurrent requests", http.StatusTooManyRequests)
 		return
 	}
 	var err error
 	defer func() {
 		if err != nil {
-			b.rateLimiter.ReturnToken(clientIP)
+			b.rateLimiter.ReturnTokens(clientKey, cost)
+			release()
 		}
 	}()
 
+	// Смена протокола (WebSocket): соединение проксируется синхронно, пока его не закроет одна из сторон
+	if isUpgrade(r) {
+		defer release()
+		var server *server.Server
+		if server, err = b.findHealthyServer(); err != nil {
+			writeError(w, r, "No healthy servers available", http.StatusServiceUnavailable)
+			return
+		}
+		b.proxyUpgrade(w, r, server)
+		return
+	}
+
 	execTime := r.Header.Get("Execution-Time")
 	if execTime == "" {
 		execTime = "0"
 	}
 
-	// Поиск здорового сервера
-	var server *server.Server
+	// Адаптивный сброс нагрузки: при росте задержек бэкендов первыми отклоняются низкоприоритетные запросы
+	priority := b.priorities.Resolve(r)
+	var slot *ShedSlot
+	if b.shedder != nil {
+		if slot, err = b.shedder.Acquire(priority); err != nil {
+			log.Printf("request from %s is shed (priority %s)", clientKey, priority)
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Service overloaded", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	// запрос, не отправленный на бэкенд, освобождает место без замера задержки
+	shedDone, shedCancel := slot.Done, slot.Cancel
+	// нет здоровых серверов: ошибка для сброса нагрузки, но не ответ бэкенда для канареечной группы
+	noServer := func() { slot.Done(0, true) }
+	// копируются только запросы, прошедшие списки доступа, лимиты и сброс нагрузки
+	if b.mirror != nil {
+		b.mirror.Copy(r)
+	}
+	// канареечная группа учитывает только запросы, дошедшие до бэкенда
+	if b.observe != nil {
+		done := shedDone
+		shedDone = func(latency time.Duration, failed bool) {
+			done(latency, failed)
+			b.observe(failed)
+		}
+	}
 
-	for range len(b.servers) - 1 {
-		server, err = b.GetNextServer()
-		if err != nil {
-			continue
+	// запрос к бэкенду не отменяется вместе с запросом клиента, сведения о запросе сохраняются
+	ctx := context.WithoutCancel(r.Context())
+	req := r.Clone(ctx)
+
+	// Копирование важных заголовков
+	for _, h := range []string{"Accept", "Accept-Encoding", "Content-Type"} {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
 		}
-		if _, err = server.CheckHealth(); err == nil {
-			break
+	}
+	// бэкенд получает приоритет, вычисленный балансировщиком
+	req.Header.Set(DefaultPriorityHeader, priority.String())
+
+	// Вызов gRPC и потоковый ответ (SSE): клиент ждёт ответа бэкенда, данные передаются без буферизации,
+	// сервер выбирается для каждого вызова отдельно
+	if grpcwire.IsGRPC(r) || server.IsEventStream(r) {
+		defer release()
+		req = req.WithContext(r.Context())
+		proxy := func(server *server.Server) { b.proxyStream(w, server, req, execTime, shedDone) }
+		if grpcwire.IsGRPC(r) {
+			proxy = func(server *server.Server) { b.proxyGRPC(w, server, req, shedDone) }
 		}
+		if err = b.runSync(w, req, priority, clientKey, cost, noServer, proxy); err != nil {
+			shedCancel()
+			log.Printf("request from %s is canceled: %v", clientKey, err)
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Request queue is full", http.StatusServiceUnavailable)
+		}
+		return
 	}
-	if err != nil {
-		http.Error(w, "No healthy servers available", http.StatusServiceUnavailable)
+
+	// Очередь с приоритетами: бэкенд выбирается, когда до запроса дойдёт очередь
+	if b.queue != nil {
+		err = b.queue.Enqueue(&Job{
+			Priority: priority,
+			Tenant:   clientKey,
+			Cost:     cost,
+			Run: func() {
+				defer release()
+				server, err := b.findHealthyServer()
+				if err != nil {
+					log.Printf("Queued request from %s dropped: %v", clientKey, err)
+					noServer()
+					b.rateLimiter.ReturnTokens(clientKey, cost)
+					return
+				}
+				b.forward(server, req, execTime, shedDone)
+			},
+		})
+		if err != nil {
+			shedCancel()
+			log.Printf("request from %s is canceled: %v", clientKey, err)
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Request queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "Request accepted and queued with priority %s\n", priority)
 		return
 	}
 
-	log.Printf("Routing request to server %d, task time: %s", server.ID, execTime)
+	// Поиск здорового сервера
+	server, err := b.findHealthyServer()
+	if err != nil {
+		noServer()
+		writeError(w, r, "No healthy servers available", http.StatusServiceUnavailable)
+		return
+	}
 
+	info.setBackend(server.ID)
 	w.WriteHeader(http.StatusAccepted)
 	fmt.Fprintf(w, "Request accepted and being processed by server %d\n", server.ID)
 
-	ctx := context.Background()
-	req := r.Clone(ctx)
+	// слот клиента освобождается после завершения запроса на бэкенде
+	go func() {
+		defer release()
+		b.forward(server, req, execTime, shedDone)
+	}()
+}
 
-	// Копирование важных заголовков
-	for _, h := range []string{"Accept", "Accept-Encoding", "Content-Type"} {
-		if v := r.Header.Get(h); v != "" {
-			req.Header.Set(h, v)
+// синхронное проксирование на здоровый сервер; при включённой очереди запрос ждёт своей очереди,
+// но проксируется в обработчике запроса клиента: потоковый ответ может длиться сколько угодно долго
+// и не должен занимать обработчик очереди. Ошибка возвращается, только если запрос не удалось поставить в очередь
+func (b *RoundRobinBalancer) runSync(w http.ResponseWriter, req *http.Request, priority Priority,
+	clientKey string, cost int, noServer func(), proxy func(*server.Server)) error {
+	if b.queue != nil {
+		admitted := make(chan struct{})
+		err := b.queue.Enqueue(&Job{
+			Priority: priority,
+			Tenant:   clientKey,
+			Cost:     cost,
+			Run:      func() { close(admitted) },
+		})
+		if err != nil {
+			return err
 		}
+		<-admitted
 	}
 
-	proxy := &httputil.ReverseProxy{
-		Director: func(r *http.Request) {
-			r.URL.Scheme = "http"
-			r.URL.Host = server.URL[len("http://"):]
-			r.URL.Path = "/process"
-			r.Header.Set("Execution-Time", execTime)
+	server, err := b.findHealthyServer()
+	if err != nil {
+		noServer()
+		b.rateLimiter.ReturnTokens(clientKey, cost)
+		writeError(w, req, "No healthy servers available", http.StatusServiceUnavailable)
+		return nil
+	}
+	proxy(server)
+	return nil
+}
+
+// поиск здорового сервера с проверкой его состояния перед отправкой
+func (b *RoundRobinBalancer) findHealthyServer() (*server.Server, error) {
+	for range len(b.servers) {
+		server, err := b.GetNextServer()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = server.CheckHealth(); err == nil {
+			return server, nil
+		}
+	}
+	return nil, ErrNoHealthyServers
+}
+
+// синхронная отправка запроса на выбранный сервер, ответ бэкенда сохраняется только в логах
+func (b *RoundRobinBalancer) forward(server *server.Server, req *http.Request, execTime string, shedDone func(time.Duration, bool)) {
+	log.Printf("Routing request to server %d, task time: %s, priority: %s",
+		server.ID, execTime, req.Header.Get(DefaultPriorityHeader))
+
+	proxy, err := b.newProxy(server, func(pr *httputil.ProxyRequest) {
+		pr.Out.URL.Path = "/process"
+		pr.Out.Header.Set("Execution-Time", execTime)
+	})
+	if err != nil {
+		log.Printf("Invalid URL of server %d: %v", server.ID, err)
+		shedDone(0, true)
+		return
+	}
+	defer server.TrackConn()()
+
+	// Буферизированный обработчик
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	proxy.ServeHTTP(recorder, req)
+	// задержка ожидания без запрошенного времени выполнения задачи
+	requested, _ := strconv.Atoi(execTime)
+	shedDone(time.Since(start)-time.Duration(requested)*time.Millisecond, recorder.Code >= 500)
+	if recorder.Code >= 400 {
+		log.Printf("Backend %d response: %d - %s",
+			server.ID, recorder.Code, recorder.Body.String())
+	}
+}
+
+// проксирование соединения со сменой протокола (WebSocket): ReverseProxy после ответа
+// 101 Switching Protocols копирует данные в обе стороны до закрытия соединения
+func (b *RoundRobinBalancer) proxyUpgrade(w http.ResponseWriter, r *http.Request, server *server.Server) {
+	proxy, err := b.newProxy(server, nil)
+	if err != nil {
+		log.Printf("Invalid URL of server %d: %v", server.ID, err)
+		writeError(w, r, "Bad gateway", http.StatusBadGateway)
+		return
+	}
+	defer server.TrackConn()()
+
+	log.Printf("Upgrading connection to %q on server %d", r.Header.Get("Upgrade"), server.ID)
+	if b.idleTimeout > 0 {
+		w = &idleResponseWriter{ResponseWriter: w, timeout: b.idleTimeout}
+	}
+	start := time.Now()
+	proxy.ServeHTTP(w, r)
+	log.Printf("Upgraded connection to server %d closed after %s", server.ID, time.Since(start).Round(time.Millisecond))
+}
+
+// создание прокси на сервер, rewrite дополнительно изменяет исходящий запрос
+func (b *RoundRobinBalancer) newProxy(server *server.Server, rewrite func(*httputil.ProxyRequest)) (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &httputil.ReverseProxy{
+		Transport: server.Transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = target.Scheme
+			pr.Out.URL.Host = target.Host
+			if rewrite != nil {
+				rewrite(pr)
+			}
+			b.resolver.SetXForwarded(pr)
+			// правила маршрута применяются последними и могут изменить любой заголовок
+			info := requestInfoFrom(pr.In.Context())
+			info.setBackend(server.ID)
+			info.applyRequest(pr.Out.Header)
 		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			log.Printf("Proxy error (server %d): %v", server.ID, err)
+			w.WriteHeader(http.StatusBadGateway)
 		},
+	}, nil
+}
+
+// проксирование потокового ответа бэкенда клиенту: каждая запись сразу отправляется клиенту
+func (b *RoundRobinBalancer) proxyStream(w http.ResponseWriter, server *server.Server, req *http.Request,
+	execTime string, shedDone func(time.Duration, bool)) {
+	log.Printf("Streaming request to server %d, task time: %s, priority: %s",
+		server.ID, execTime, req.Header.Get(DefaultPriorityHeader))
+
+	proxy, err := b.newProxy(server, func(pr *httputil.ProxyRequest) {
+		pr.Out.URL.Path = "/process"
+		pr.Out.Header.Set("Execution-Time", execTime)
+	})
+	if err != nil {
+		log.Printf("Invalid URL of server %d: %v", server.ID, err)
+		shedDone(0, true)
+		writeError(w, req, "Bad gateway", http.StatusBadGateway)
+		return
 	}
+	proxy.FlushInterval = -1 // без буферизации
+	defer server.TrackConn()()
 
-	// Буферизированный обработчик
-	recorder := httptest.NewRecorder()
-	go func() {
-		proxy.ServeHTTP(recorder, req)
-		if recorder.Code >= 400 {
-			log.Printf("Backend %d response: %d - %s",
-				server.ID, recorder.Code, recorder.Body.String())
+	status := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	start := time.Now()
+	proxy.ServeHTTP(status, req)
+	requested, _ := strconv.Atoi(execTime)
+	shedDone(time.Since(start)-time.Duration(requested)*time.Millisecond, status.code >= 500)
+}
+
+// statusWriter запоминает код ответа, не мешая потоковой передаче
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// проксирование вызова gRPC: путь (сервис и метод) сохраняется, ошибки соединения
+// с бэкендом и HTTP-ошибки без статуса gRPC передаются клиенту как статус gRPC.
+// Задержкой для сброса нагрузки считается время до заголовков ответа, а не длительность
+// вызова: потоковые вызовы могут длиться сколько угодно долго.
+func (b *RoundRobinBalancer) proxyGRPC(w http.ResponseWriter, server *server.Server, req *http.Request,
+	shedDone func(time.Duration, bool)) {
+	log.Printf("Routing gRPC call %s to server %d", req.URL.Path, server.ID)
+
+	proxy, err := b.newProxy(server, nil)
+	if err != nil {
+		log.Printf("Invalid URL of server %d: %v", server.ID, err)
+		shedDone(0, true)
+		grpcwire.WriteError(w, grpcwire.Unavailable, "invalid backend address")
+		return
+	}
+	start := time.Now()
+	reported := false
+	report := func(failed bool) {
+		if !reported {
+			reported = true
+			shedDone(time.Since(start), failed)
 		}
-	}()
+	}
+	proxy.FlushInterval = -1 // потоковые вызовы передаются без буферизации
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode == http.StatusOK || resp.Header.Get("Grpc-Status") != "" {
+			report(false)
+			return nil
+		}
+		// ответ не от gRPC-сервера: заменяется ответом trailers-only
+		report(resp.StatusCode >= 500)
+		code := grpcwire.FromHTTPStatus(resp.StatusCode)
+		resp.Body.Close()
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+		resp.Header = make(http.Header)
+		grpcwire.SetStatus(resp.Header, code, fmt.Sprintf("backend returned HTTP %d", resp.StatusCode))
+		resp.StatusCode = http.StatusOK
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Proxy error (server %d): %v", server.ID, err)
+		report(true)
+		grpcwire.WriteError(w, grpcwire.Unavailable, "backend unavailable")
+	}
+	defer server.TrackConn()()
+
+	proxy.ServeHTTP(w, req)
+}
+
+// ответ об ошибке: для вызовов gRPC - статус gRPC в ответе trailers-only
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if grpcwire.IsGRPC(r) {
+		grpcwire.WriteError(w, grpcwire.FromHTTPStatus(status), message)
+		return
+	}
+	http.Error(w, message, status)
 }
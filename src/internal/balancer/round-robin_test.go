@@ -0,0 +1,273 @@
+package balancer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/server"
+	"github.com/pozedorum/load_balancer/pkg/ratelimit"
+)
+
+// newTestServer создает сервер балансировщика для бэкенда по адресу addr
+func newTestServer(t *testing.T, id int, addr string, health string) *server.Server {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, _ := strconv.Atoi(port)
+	srv, err := server.NewFromConfig(config.ServerConfig{ID: id, Host: host, Port: portNum, HealthCheck: health},
+		server.NewTransportPool(config.UpstreamConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+// newTestPool создает пул из бэкендов с обработчиками handlers (ID серверов с 1)
+func newTestPool(t *testing.T, handlers ...http.Handler) *RoundRobinBalancer {
+	t.Helper()
+	servers := make([]*server.Server, 0, len(handlers))
+	for i, h := range handlers {
+		ts := httptest.NewServer(h)
+		t.Cleanup(ts.Close)
+		servers = append(servers, newTestServer(t, i+1, ts.Listener.Addr().String(), server.HealthCheckNone))
+	}
+	return newPoolOf(t, servers...)
+}
+
+// newPoolOf создает пул из серверов со своим ограничителем запросов
+func newPoolOf(t *testing.T, servers ...*server.Server) *RoundRobinBalancer {
+	t.Helper()
+	limiter := ratelimit.NewRateLimiter(time.Minute, time.Minute)
+	t.Cleanup(limiter.Stop)
+	return NewRoundRobinBalancerWithLimiter(servers, limiter)
+}
+
+// recordHeaders возвращает обработчик, отправляющий заголовки запросов в канал
+func recordHeaders(ch chan<- http.Header) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ch <- r.Header.Clone()
+	})
+}
+
+// waitHeaders ждёт заголовки запроса, пришедшего на бэкенд
+func waitHeaders(t *testing.T, ch <-chan http.Header) http.Header {
+	t.Helper()
+	select {
+	case h := <-ch:
+		return h
+	case <-time.After(5 * time.Second):
+		t.Fatal("request did not reach the backend")
+		return nil
+	}
+}
+
+// closedAddr возвращает адрес, на котором никто не принимает соединения
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// newDeadPool создает пул из одного недоступного сервера (TCP health check не проходит)
+func newDeadPool(t *testing.T) *RoundRobinBalancer {
+	t.Helper()
+	return newPoolOf(t, newTestServer(t, 1, closedAddr(t), server.HealthCheckTCP))
+}
+
+// ключ клиента httptest.NewRequest (лимиты по IP)
+const testClient = "192.0.2.1"
+
+// setTestLimits задаёт клиенту 10 токенов практически без пополнения
+func setTestLimits(t *testing.T, b *RoundRobinBalancer, maxInFlight int) {
+	t.Helper()
+	err := b.RateLimiter().SetLimits(testClient, config.ClientConfig{Capacity: 10, Rate: 0.0001, MaxInFlight: maxInFlight})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// remaining возвращает запас токенов клиента
+func remaining(b *RoundRobinBalancer) int {
+	state, _ := b.RateLimiter().State(testClient, 1)
+	return state.Remaining
+}
+
+// waitRemaining ждёт, пока запас токенов клиента станет равен want
+func waitRemaining(t *testing.T, b *RoundRobinBalancer, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for remaining(b) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("remaining = %d, want %d", remaining(b), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// serve передаёт запрос балансировщику и возвращает ответ
+func serve(b *RoundRobinBalancer, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	b.HandleRequest(rec, r)
+	return rec
+}
+
+// запрос, не дошедший до бэкенда из-за отсутствия здоровых серверов, не тратит токены
+func TestNoHealthyServerRefund(t *testing.T) {
+	tests := []struct {
+		name   string
+		queue  bool
+		accept string
+		status int
+	}{
+		{"sync", false, "", http.StatusServiceUnavailable},
+		{"queued", true, "", http.StatusAccepted},
+		{"stream", false, "text/event-stream", http.StatusServiceUnavailable},
+		{"queued stream", true, "text/event-stream", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newDeadPool(t)
+			setTestLimits(t, b, 0)
+			if tt.queue {
+				b.EnableQueue(config.QueueConfig{})
+			}
+			b.SetShedder(NewShedder(config.SheddingConfig{InitialLimit: 10}))
+
+			r := httptest.NewRequest(http.MethodPost, "/process", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if rec := serve(b, r); rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			// очередь отправляет запрос позже, токены возвращаются после попытки
+			waitRemaining(t, b, 10)
+			if _, inFlight := b.shedder.Stats(); inFlight != 0 {
+				t.Fatalf("shedder in flight = %d, want 0", inFlight)
+			}
+		})
+	}
+}
+
+// переполненная очередь отвечает 503 с Retry-After, возвращает токены
+// и освобождает место в сбросе нагрузки без изменения лимита
+func TestQueueFull(t *testing.T) {
+	for _, accept := range []string{"", "text/event-stream"} {
+		t.Run("accept "+accept, func(t *testing.T) {
+			started, release := make(chan struct{}, 1), make(chan struct{})
+			b := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				started <- struct{}{}
+				<-release
+			}))
+			defer close(release)
+			setTestLimits(t, b, 0)
+			b.EnableQueue(config.QueueConfig{Workers: 1, MaxQueued: 1})
+			shedder := NewShedder(config.SheddingConfig{InitialLimit: 10, MaxLimit: 10})
+			b.SetShedder(shedder)
+
+			// первый запрос занимает обработчик очереди, второй ждёт в очереди
+			go serve(b, httptest.NewRequest(http.MethodPost, "/process", nil))
+			<-started
+			b.queue.Enqueue(&Job{Tenant: "other", Run: func() {}})
+
+			r := httptest.NewRequest(http.MethodPost, "/process", nil)
+			if accept != "" {
+				r.Header.Set("Accept", accept)
+			}
+			rec := serve(b, r)
+			if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+				t.Fatalf("status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+			}
+			if got := remaining(b); got != 9 {
+				t.Fatalf("remaining = %d, want 9 (tokens of the rejected request returned)", got)
+			}
+			if limit, inFlight := shedder.Stats(); limit != 10 || inFlight != 1 {
+				t.Fatalf("shedder = (%v, %d), want (10, 1)", limit, inFlight)
+			}
+		})
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	b := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err := b.RateLimiter().SetLimits(testClient, config.ClientConfig{Capacity: 1, Rate: 0.0001}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(b, httptest.NewRequest(http.MethodPost, "/process", nil)); rec.Code != http.StatusAccepted {
+		t.Fatalf("first request status = %d, want 202", rec.Code)
+	}
+	rec := serve(b, httptest.NewRequest(http.MethodPost, "/process", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+}
+
+func TestAccessDenied(t *testing.T) {
+	b := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	path := t.TempDir() + "/rate_limits.json"
+	if err := os.WriteFile(path, []byte(`{"default": {"capacity": 10, "rate": 1}, "deny": ["192.0.2.0/24"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	b.rateLimiter = ratelimit.NewRateLimiterFromFile(path, time.Minute, time.Minute)
+	t.Cleanup(b.rateLimiter.Stop)
+	if rec := serve(b, httptest.NewRequest(http.MethodPost, "/process", nil)); rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+}
+
+// при превышении max_in_flight клиент получает 429 с Retry-After,
+// а заголовки лимита показывают запас после возврата токенов
+func TestInFlightLimit(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	b := newTestPool(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	setTestLimits(t, b, 1)
+
+	if rec := serve(b, httptest.NewRequest(http.MethodPost, "/process", nil)); rec.Code != http.StatusAccepted {
+		t.Fatalf("first request status = %d, want 202", rec.Code)
+	}
+	<-started // первый запрос выполняется на бэкенде и занимает слот клиента
+
+	rec := serve(b, httptest.NewRequest(http.MethodPost, "/process", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Fatalf("Retry-After = %q, want 1", got)
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "9" {
+		t.Fatalf("RateLimit-Remaining = %q, want 9", got)
+	}
+
+	// после завершения запроса слот освобождается
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, _ := b.RateLimiter().ClientInfo(testClient)
+		if info.InFlight == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("in-flight slot is not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
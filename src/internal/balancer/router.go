@@ -0,0 +1,135 @@
+package balancer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// DefaultPool - пул для запросов без подходящего маршрута
+const DefaultPool = "default"
+
+// Router выбирает пул по имени хоста (виртуальные хосты), префиксу пути и условиям маршрута,
+// маршруты проверяются по убыванию приоритета, при равенстве - в порядке объявления
+type Router struct {
+	routes   []route
+	fallback http.Handler // пул для запросов без подходящего маршрута
+}
+
+// route - маршрут в пул
+type route struct {
+	hosts    []string      // имена хостов в нижнем регистре, "*.example.com" - любой поддомен
+	path     string        // префикс пути
+	matcher  *Matcher      // дополнительные условия (nil - без условий)
+	headers  *HeaderPolicy // изменение заголовков (nil - без изменений)
+	priority int
+	pool     string
+	handler  http.Handler
+}
+
+// NewRouter создает маршрутизатор, все пулы и серверы маршрутов должны существовать
+func NewRouter(routes []config.RouteConfig, fallback string, pools map[string]*RoundRobinBalancer) (*Router, error) {
+	rt := &Router{routes: make([]route, 0, len(routes))}
+	for i, cfg := range routes {
+		pool, ok := pools[cfg.Pool]
+		if !ok {
+			return nil, fmt.Errorf("route %d: unknown pool %q", i, cfg.Pool)
+		}
+		var handler http.Handler = pool
+		if len(cfg.Servers) > 0 {
+			subset, err := pool.Subset(cfg.Servers)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: %w", i, err)
+			}
+			handler = subset
+		}
+		var matcher *Matcher
+		if cfg.Match != nil {
+			var err error
+			if matcher, err = NewMatcher(*cfg.Match); err != nil {
+				return nil, fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+		var headers *HeaderPolicy
+		if cfg.Headers != nil {
+			headers = NewHeaderPolicy(*cfg.Headers)
+		}
+		hosts := make([]string, 0, len(cfg.Hosts))
+		for _, host := range cfg.Hosts {
+			hosts = append(hosts, strings.ToLower(host))
+		}
+		rt.routes = append(rt.routes, route{
+			hosts:    hosts,
+			path:     cfg.Path,
+			matcher:  matcher,
+			headers:  headers,
+			priority: cfg.Priority,
+			pool:     cfg.Pool,
+			handler:  handler,
+		})
+	}
+	sort.SliceStable(rt.routes, func(i, j int) bool { return rt.routes[i].priority > rt.routes[j].priority })
+
+	if fallback == "" {
+		fallback = DefaultPool
+	}
+	pool, ok := pools[fallback]
+	if !ok {
+		return nil, fmt.Errorf("unknown fallback pool %q", fallback)
+	}
+	rt.fallback = pool
+	return rt, nil
+}
+
+// ServeHTTP передаёт запрос в пул первого подходящего маршрута,
+// идентификатор запроса (X-Request-ID) возвращается клиенту в ответе
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, info := withRequestInfo(r)
+	w.Header().Set(RequestIDHeader, info.requestID)
+
+	host := requestHost(r)
+	for _, route := range rt.routes {
+		if route.match(host, r) {
+			if route.headers != nil {
+				info.policy = route.headers
+				w = &headerWriter{ResponseWriter: w, info: info}
+			}
+			route.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	rt.fallback.ServeHTTP(w, r)
+}
+
+// проверка маршрута по хосту, пути и условиям
+func (ro *route) match(host string, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, ro.path) {
+		return false
+	}
+	if len(ro.hosts) > 0 && !slices.ContainsFunc(ro.hosts, func(pattern string) bool { return matchHost(pattern, host) }) {
+		return false
+	}
+	return ro.matcher.Match(r)
+}
+
+// matchHost сравнивает хост с шаблоном, "*.example.com" подходит для любого поддомена example.com
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+// имя хоста запроса в нижнем регистре без порта
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
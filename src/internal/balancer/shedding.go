@@ -0,0 +1,125 @@
+package balancer
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+var ErrOverloaded = errors.New("load shedding: balancer is overloaded")
+
+// доля лимита одновременных запросов, доступная каждому приоритету:
+// низкоприоритетные запросы начинают отклоняться раньше остальных
+var priorityShare = map[Priority]float64{
+	PriorityLow:      0.5,
+	PriorityNormal:   0.75,
+	PriorityHigh:     0.9,
+	PriorityCritical: 1,
+}
+
+// Shedder - адаптивный ограничитель одновременных запросов к бэкендам (AIMD).
+// Лимит растёт на 1/limit при каждом успешном запросе с задержкой не выше целевой
+// и умножается на backoff при превышении задержки или ошибке бэкенда.
+// Задержка считается без запрошенного времени выполнения задачи, то есть
+// отражает только ожидание в очередях бэкендов.
+type Shedder struct {
+	mu            sync.Mutex
+	limit         float64       // текущий лимит одновременных запросов
+	inFlight      int           // выполняющихся запросов
+	minLimit      float64       // нижняя граница лимита
+	maxLimit      float64       // верхняя граница лимита
+	targetLatency time.Duration // целевая задержка
+	backoff       float64       // множитель уменьшения лимита
+}
+
+// NewShedder создает Shedder по настройкам
+func NewShedder(cfg config.SheddingConfig) *Shedder {
+	s := &Shedder{
+		limit:         float64(cfg.InitialLimit),
+		minLimit:      float64(cfg.MinLimit),
+		maxLimit:      float64(cfg.MaxLimit),
+		targetLatency: cfg.TargetLatency.Duration,
+		backoff:       cfg.Backoff,
+	}
+	if s.minLimit < 1 {
+		s.minLimit = 1
+	}
+	if s.maxLimit < s.minLimit {
+		s.maxLimit = math.Max(s.minLimit, 100)
+	}
+	if s.limit < s.minLimit || s.limit > s.maxLimit {
+		s.limit = s.minLimit
+	}
+	if s.targetLatency <= 0 {
+		s.targetLatency = time.Second
+	}
+	if s.backoff <= 0 || s.backoff >= 1 {
+		s.backoff = 0.9
+	}
+	return s
+}
+
+// ShedSlot - место запроса в лимите Shedder, освобождается один раз: Done или Cancel
+type ShedSlot struct {
+	shedder *Shedder
+	once    sync.Once
+}
+
+// Done освобождает место после ответа бэкенда и корректирует лимит
+// по задержке ожидания и признаку ошибки бэкенда
+func (slot *ShedSlot) Done(latency time.Duration, failed bool) {
+	if slot == nil {
+		return
+	}
+	slot.once.Do(func() { slot.shedder.release(latency, failed) })
+}
+
+// Cancel освобождает место запроса, который не был отправлен на бэкенд
+// (например, очередь заполнена), лимит не меняется
+func (slot *ShedSlot) Cancel() {
+	if slot == nil {
+		return
+	}
+	slot.once.Do(slot.shedder.cancel)
+}
+
+// Acquire пропускает запрос, если для его приоритета есть место в текущем лимите.
+// Место нужно освободить через Done или Cancel возвращённого ShedSlot.
+func (s *Shedder) Acquire(p Priority) (*ShedSlot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if float64(s.inFlight) >= math.Max(1, s.limit*priorityShare[p]) {
+		return nil, ErrOverloaded
+	}
+	s.inFlight++
+	return &ShedSlot{shedder: s}, nil
+}
+
+// cancel освобождает место без изменения лимита
+func (s *Shedder) cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+}
+
+// release завершает запрос и корректирует лимит
+func (s *Shedder) release(latency time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	if failed || latency > s.targetLatency {
+		s.limit = math.Max(s.minLimit, s.limit*s.backoff)
+		return
+	}
+	s.limit = math.Min(s.maxLimit, s.limit+1/s.limit)
+}
+
+// Stats возвращает текущий лимит и количество выполняющихся запросов
+func (s *Shedder) Stats() (limit float64, inFlight int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit, s.inFlight
+}
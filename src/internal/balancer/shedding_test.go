@@ -0,0 +1,84 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+func newTestShedder(limit int) *Shedder {
+	return NewShedder(config.SheddingConfig{
+		InitialLimit:  limit,
+		MinLimit:      1,
+		MaxLimit:      100,
+		TargetLatency: config.Duration{Duration: 100 * time.Millisecond},
+		Backoff:       0.5,
+	})
+}
+
+func TestShedderPriorities(t *testing.T) {
+	s := newTestShedder(10)
+	for range 5 {
+		if _, err := s.Acquire(PriorityLow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// low занимает не больше половины лимита, critical - весь лимит
+	if _, err := s.Acquire(PriorityLow); err != ErrOverloaded {
+		t.Fatalf("low: err = %v, want ErrOverloaded", err)
+	}
+	for range 5 {
+		if _, err := s.Acquire(PriorityCritical); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Acquire(PriorityCritical); err != ErrOverloaded {
+		t.Fatalf("critical: err = %v, want ErrOverloaded", err)
+	}
+}
+
+func TestShedSlot(t *testing.T) {
+	tests := []struct {
+		name      string
+		release   func(*ShedSlot)
+		wantLimit float64
+	}{
+		{"fast response", func(slot *ShedSlot) { slot.Done(10*time.Millisecond, false) }, 10.1},
+		{"slow response", func(slot *ShedSlot) { slot.Done(time.Second, false) }, 5},
+		{"backend error", func(slot *ShedSlot) { slot.Done(0, true) }, 5},
+		{"cancel", func(slot *ShedSlot) { slot.Cancel() }, 10},
+		{"cancel after done", func(slot *ShedSlot) {
+			slot.Done(10*time.Millisecond, false)
+			slot.Cancel()
+		}, 10.1},
+		{"done twice", func(slot *ShedSlot) {
+			slot.Done(0, true)
+			slot.Done(0, true)
+		}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestShedder(10)
+			slot, err := s.Acquire(PriorityNormal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.release(slot)
+			limit, inFlight := s.Stats()
+			if inFlight != 0 {
+				t.Fatalf("inFlight = %d, want 0", inFlight)
+			}
+			if limit != tt.wantLimit {
+				t.Fatalf("limit = %v, want %v", limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+// nil-слот (сброс нагрузки выключен) можно освобождать без проверок
+func TestShedSlotNil(t *testing.T) {
+	var slot *ShedSlot
+	slot.Done(0, true)
+	slot.Cancel()
+}
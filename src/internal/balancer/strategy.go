@@ -0,0 +1,93 @@
+package balancer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pozedorum/load_balancer/internal/server"
+)
+
+// Названия стратегий выбора сервера (поле strategy в balancer.json)
+const (
+	StrategyRoundRobin       = "round_robin"
+	StrategyLeastConnections = "least_connections"
+)
+
+// Strategy выбирает здоровый сервер из списка
+type Strategy interface {
+	Next(servers []*server.Server) (*server.Server, error)
+}
+
+// NewStrategy создает стратегию по названию (пустое - round robin)
+func NewStrategy(name string) (Strategy, error) {
+	switch name {
+	case "", StrategyRoundRobin:
+		return &RoundRobin{}, nil
+	case StrategyLeastConnections:
+		return &LeastConnections{}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy %q", name)
+	}
+}
+
+// newStrategyLike создает новую стратегию того же типа (со своим состоянием)
+func newStrategyLike(strategy Strategy) Strategy {
+	switch strategy.(type) {
+	case *LeastConnections:
+		return &LeastConnections{}
+	default:
+		return &RoundRobin{}
+	}
+}
+
+// RoundRobin выбирает здоровые серверы по очереди
+type RoundRobin struct {
+	lock    sync.Mutex // мьютекс блокировки данных
+	current int        // текущий сервер выбранный для отправки запроса
+}
+
+func (s *RoundRobin) Next(servers []*server.Server) (*server.Server, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for range len(servers) {
+		server := servers[s.current%len(servers)]
+		s.current = (s.current + 1) % len(servers)
+
+		if server.IsHealthy() {
+			return server, nil
+		}
+	}
+
+	return nil, ErrNoHealthyServers
+}
+
+// LeastConnections выбирает здоровый сервер с наименьшим числом проксируемых запросов
+// и соединений (включая долгоживущие WebSocket), при равенстве - по очереди
+type LeastConnections struct {
+	lock  sync.Mutex
+	start int // с какого сервера начинается поиск
+}
+
+func (s *LeastConnections) Next(servers []*server.Server) (*server.Server, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var best *server.Server
+	for i := range len(servers) {
+		server := servers[(s.start+i)%len(servers)]
+		if !server.IsHealthy() {
+			continue
+		}
+		if best == nil || server.ActiveConns() < best.ActiveConns() {
+			best = server
+		}
+	}
+	if best == nil {
+		return nil, ErrNoHealthyServers
+	}
+	if len(servers) > 0 {
+		s.start = (s.start + 1) % len(servers)
+	}
+	return best, nil
+}
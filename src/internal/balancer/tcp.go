@@ -0,0 +1,155 @@
+package balancer
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/server"
+)
+
+// таймауты по умолчанию: соединения с бэкендом и простоя соединения
+const (
+	defaultConnectTimeout = 5 * time.Second
+	defaultTCPIdleTimeout = 5 * time.Minute
+)
+
+// TCPProxy - L4-балансировщик: принимает TCP-соединения и передаёт байты
+// в обе стороны на выбранный по стратегии бэкенд
+type TCPProxy struct {
+	name           string
+	servers        []*server.Server
+	strategy       Strategy
+	connectTimeout time.Duration
+	idleTimeout    time.Duration // таймаут простоя соединения
+}
+
+// NewTCPProxy создает L4-балансировщик и запускает проверку состояния серверов
+func NewTCPProxy(cfg config.TCPConfig, servers []*server.Server) (*TCPProxy, error) {
+	strategy, err := NewStrategy(cfg.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	connectTimeout := cfg.ConnectTimeout.Duration
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+	idleTimeout := cfg.IdleTimeout.Duration
+	if idleTimeout <= 0 {
+		idleTimeout = defaultTCPIdleTimeout
+	}
+	p := &TCPProxy{
+		name:           cfg.Name,
+		servers:        servers,
+		strategy:       strategy,
+		connectTimeout: connectTimeout,
+		idleTimeout:    idleTimeout,
+	}
+	go startHealthCheck(servers)
+	return p, nil
+}
+
+// Serve принимает соединения, пока listener не будет закрыт
+func (p *TCPProxy) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		go p.handle(conn)
+	}
+}
+
+// обработка соединения клиента
+func (p *TCPProxy) handle(client net.Conn) {
+	defer client.Close()
+
+	server, backend, err := p.dial()
+	if err != nil {
+		log.Printf("TCP %s: connection from %s is dropped: %v", p.name, client.RemoteAddr(), err)
+		return
+	}
+	defer backend.Close()
+	defer server.TrackConn()()
+
+	start := time.Now()
+	sent, received := p.splice(client, backend)
+	log.Printf("TCP %s: connection %s <-> server %d closed after %s (sent %d, received %d bytes)",
+		p.name, client.RemoteAddr(), server.ID, time.Since(start).Round(time.Millisecond), sent, received)
+}
+
+// соединение со здоровым сервером; при ошибке соединения сервер перепроверяется
+// и выбирается следующий
+func (p *TCPProxy) dial() (*server.Server, net.Conn, error) {
+	for range len(p.servers) {
+		server, err := p.strategy.Next(p.servers)
+		if err != nil {
+			return nil, nil, err
+		}
+		conn, err := net.DialTimeout("tcp", server.Addr, p.connectTimeout)
+		if err == nil {
+			return server, conn, nil
+		}
+		log.Printf("TCP %s: failed to connect to server %d: %v", p.name, server.ID, err)
+		server.CheckHealth()
+	}
+	return nil, nil, ErrNoHealthyServers
+}
+
+// передача байтов в обе стороны; когда одна сторона закончила передачу,
+// другой отправляется FIN (half-close), соединения закрываются после завершения обеих сторон.
+// При ошибке или простое дольше idleTimeout (в том числе после half-close) оба соединения
+// закрываются сразу, чтобы вторая сторона не ждала бесконечно.
+func (p *TCPProxy) splice(client, backend net.Conn) (sent, received int64) {
+	deadline := time.Now().Add(p.idleTimeout)
+	client.SetDeadline(deadline)
+	backend.SetDeadline(deadline)
+	src := &idleConn{Conn: client, timeout: p.idleTimeout}
+	dst := &idleConn{Conn: backend, timeout: p.idleTimeout}
+
+	finish := func(err error, peer net.Conn) {
+		if err != nil {
+			client.Close()
+			backend.Close()
+			return
+		}
+		closeWrite(peer)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var err error
+		sent, err = io.Copy(dst, src)
+		finish(err, backend)
+	}()
+	go func() {
+		defer wg.Done()
+		var err error
+		received, err = io.Copy(src, dst)
+		finish(err, client)
+	}()
+	wg.Wait()
+	return sent, received
+}
+
+// закрытие соединения на запись, если оно это поддерживает
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
+}
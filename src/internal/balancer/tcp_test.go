@@ -0,0 +1,124 @@
+package balancer
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/server"
+)
+
+// echoTCP запускает TCP-бэкенд, возвращающий полученные байты
+func echoTCP(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// startTCPProxy запускает TCP-балансировщик перед серверами и возвращает его адрес
+func startTCPProxy(t *testing.T, cfg config.TCPConfig, servers ...*server.Server) string {
+	t.Helper()
+	p, err := NewTCPProxy(cfg, servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go p.Serve(l)
+	return l.Addr().String()
+}
+
+// waitClosed проверяет, что балансировщик закрыл соединение клиента
+func waitClosed(t *testing.T, conn net.Conn, within time.Duration) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(within))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection to be closed, got %v", err)
+	}
+}
+
+func TestTCPProxyRoundTrip(t *testing.T) {
+	addr := startTCPProxy(t, config.TCPConfig{Name: "test"},
+		newTestServer(t, 1, echoTCP(t), server.HealthCheckTCP))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("expected echo %q, got %q", "ping", buf)
+	}
+
+	// half-close клиента передаётся бэкенду, бэкенд закрывает соединение в ответ
+	conn.(*net.TCPConn).CloseWrite()
+	waitClosed(t, conn, 5*time.Second)
+}
+
+func TestTCPProxyIdleTimeout(t *testing.T) {
+	addr := startTCPProxy(t, config.TCPConfig{
+		Name:        "test",
+		IdleTimeout: config.Duration{Duration: 100 * time.Millisecond},
+	}, newTestServer(t, 1, echoTCP(t), server.HealthCheckTCP))
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	waitClosed(t, conn, 5*time.Second)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("idle connection closed after %s", elapsed)
+	}
+}
+
+func TestTCPProxyNoHealthyServer(t *testing.T) {
+	srv := newTestServer(t, 1, closedAddr(t), server.HealthCheckTCP)
+	addr := startTCPProxy(t, config.TCPConfig{Name: "test"}, srv)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	waitClosed(t, conn, 5*time.Second)
+	if srv.IsHealthy() {
+		t.Fatal("failed dial should mark the server unhealthy")
+	}
+	if n := srv.ActiveConns(); n != 0 {
+		t.Fatalf("expected no active connections, got %d", n)
+	}
+}
@@ -0,0 +1,213 @@
+package balancer
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/server"
+)
+
+// время жизни сессии без датаграмм по умолчанию
+const defaultSessionTimeout = 30 * time.Second
+
+// максимальный размер датаграммы
+const maxDatagramSize = 64 * 1024
+
+// максимальное количество сессий по умолчанию
+const defaultMaxSessions = 1024
+
+var ErrTooManySessions = errors.New("too many UDP sessions")
+
+// UDPProxy - балансировщик UDP: датаграммы клиента передаются на бэкенд, выбранный
+// при первой датаграмме (сессия по адресу клиента), ответы возвращаются клиенту
+type UDPProxy struct {
+	name     string
+	servers  []*server.Server
+	strategy Strategy
+	timeout  time.Duration // время жизни сессии без датаграмм
+	conn     *net.UDPConn  // сокет, на котором принимаются датаграммы клиентов
+
+	mu          sync.Mutex
+	sessions    map[string]*udpSession // сессии по адресу клиента
+	maxSessions int                    // максимальное количество сессий (у каждой свой сокет и горутина)
+	full        bool                   // достигнут лимит сессий (для однократного сообщения в лог)
+}
+
+// udpSession - привязка клиента к бэкенду
+type udpSession struct {
+	client   *net.UDPAddr
+	server   *server.Server
+	upstream *net.UDPConn // сокет, соединённый с бэкендом (ответы приходят только от него)
+	lastSeen atomic.Int64 // время последней датаграммы в любую сторону (UnixNano)
+	done     func()       // завершение учёта соединения на сервере
+}
+
+// NewUDPProxy создает балансировщик UDP и запускает проверку состояния серверов
+func NewUDPProxy(cfg config.UDPConfig, servers []*server.Server) (*UDPProxy, error) {
+	strategy, err := NewStrategy(cfg.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.SessionTimeout.Duration
+	if timeout <= 0 {
+		timeout = defaultSessionTimeout
+	}
+	maxSessions := cfg.MaxSessions
+	if maxSessions <= 0 {
+		maxSessions = defaultMaxSessions
+	}
+	p := &UDPProxy{
+		name:        cfg.Name,
+		servers:     servers,
+		strategy:    strategy,
+		timeout:     timeout,
+		sessions:    make(map[string]*udpSession),
+		maxSessions: maxSessions,
+	}
+	go startHealthCheck(servers)
+	return p, nil
+}
+
+// Serve принимает датаграммы, пока сокет не будет закрыт
+func (p *UDPProxy) Serve(conn *net.UDPConn) error {
+	p.conn = conn
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		session, err := p.session(client)
+		if errors.Is(err, ErrTooManySessions) {
+			continue
+		}
+		if err != nil {
+			log.Printf("UDP %s: datagram from %s is dropped: %v", p.name, client, err)
+			continue
+		}
+		session.lastSeen.Store(time.Now().UnixNano())
+		if _, err := session.upstream.Write(buf[:n]); err != nil {
+			log.Printf("UDP %s: failed to send to server %d: %v", p.name, session.server.ID, err)
+		}
+	}
+}
+
+// session возвращает сессию клиента; новая сессия создается, если её нет
+// или сервер сессии перестал быть здоровым. Адрес клиента UDP легко подделать,
+// поэтому при лимите сессий датаграммы новых клиентов отбрасываются
+// (существующие сессии не вытесняются), пока старые сессии не истекут.
+// Адрес бэкенда разрешается и сокет открывается без мьютекса: медленный DNS
+// не должен задерживать датаграммы клиентов с уже открытыми сессиями.
+func (p *UDPProxy) session(client *net.UDPAddr) (*udpSession, error) {
+	key := client.String()
+
+	p.mu.Lock()
+	if session, ok := p.sessions[key]; ok {
+		if session.server.IsHealthy() {
+			p.mu.Unlock()
+			return session, nil
+		}
+		p.closeSession(key, session)
+	}
+	err := p.checkLimit()
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := p.strategy.Next(p.servers)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveUDPAddr("udp", server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// пока открывался сокет, сессия могла появиться или лимит мог заполниться
+	if session, ok := p.sessions[key]; ok {
+		if session.server.IsHealthy() {
+			upstream.Close()
+			return session, nil
+		}
+		p.closeSession(key, session)
+	}
+	if err := p.checkLimit(); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	session := &udpSession{
+		client:   client,
+		server:   server,
+		upstream: upstream,
+		done:     server.TrackConn(),
+	}
+	session.lastSeen.Store(time.Now().UnixNano())
+	p.sessions[key] = session
+	go p.relay(key, session)
+	return session, nil
+}
+
+// checkLimit проверяет лимит сессий, вызывается под мьютексом
+func (p *UDPProxy) checkLimit() error {
+	if len(p.sessions) >= p.maxSessions {
+		if !p.full {
+			p.full = true
+			log.Printf("UDP %s: session limit %d reached, datagrams from new clients are dropped", p.name, p.maxSessions)
+		}
+		return ErrTooManySessions
+	}
+	p.full = false
+	return nil
+}
+
+// relay возвращает клиенту ответы бэкенда, пока сессия активна
+func (p *UDPProxy) relay(key string, session *udpSession) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		session.upstream.SetReadDeadline(time.Now().Add(p.timeout))
+		n, err := session.upstream.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !p.expired(session) {
+				continue
+			}
+			p.mu.Lock()
+			if p.sessions[key] == session {
+				p.closeSession(key, session)
+			}
+			p.mu.Unlock()
+			return
+		}
+		session.lastSeen.Store(time.Now().UnixNano())
+		if _, err := p.conn.WriteToUDP(buf[:n], session.client); err != nil {
+			log.Printf("UDP %s: failed to reply to %s: %v", p.name, session.client, err)
+		}
+	}
+}
+
+// expired проверяет, что в сессии не было датаграмм дольше timeout
+func (p *UDPProxy) expired(session *udpSession) bool {
+	return time.Since(time.Unix(0, session.lastSeen.Load())) >= p.timeout
+}
+
+// closeSession удаляет сессию, вызывается под мьютексом
+func (p *UDPProxy) closeSession(key string, session *udpSession) {
+	delete(p.sessions, key)
+	session.upstream.Close()
+	session.done()
+}
@@ -0,0 +1,141 @@
+package balancer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/internal/server"
+)
+
+// echoUDP запускает UDP-бэкенд, отвечающий адресом отправителя датаграммы
+func echoUDP(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			_, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP([]byte(addr.String()), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// startUDPProxy запускает UDP-балансировщик перед серверами
+func startUDPProxy(t *testing.T, cfg config.UDPConfig, servers ...*server.Server) (*UDPProxy, *net.UDPAddr) {
+	t.Helper()
+	p, err := NewUDPProxy(cfg, servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go p.Serve(conn)
+	return p, conn.LocalAddr().(*net.UDPAddr)
+}
+
+// udpClient открывает сокет клиента, соединённый с балансировщиком
+func udpClient(t *testing.T, addr *net.UDPAddr) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// exchange отправляет датаграмму и возвращает ответ ("" если ответа нет за timeout)
+func exchange(t *testing.T, conn *net.UDPConn, timeout time.Duration) string {
+	t.Helper()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+// sessionCount возвращает количество сессий балансировщика
+func sessionCount(p *UDPProxy) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+func TestUDPProxySessionReuse(t *testing.T) {
+	srv := newTestServer(t, 1, echoUDP(t), server.HealthCheckNone)
+	p, addr := startUDPProxy(t, config.UDPConfig{Name: "test"}, srv)
+	client := udpClient(t, addr)
+
+	first := exchange(t, client, 5*time.Second)
+	if first == "" {
+		t.Fatal("no reply from backend")
+	}
+	// датаграммы клиента идут через тот же сокет сессии
+	if second := exchange(t, client, 5*time.Second); second != first {
+		t.Fatalf("expected the same upstream %s, got %s", first, second)
+	}
+	if n := sessionCount(p); n != 1 {
+		t.Fatalf("expected 1 session, got %d", n)
+	}
+	if n := srv.ActiveConns(); n != 1 {
+		t.Fatalf("expected 1 active session on server, got %d", n)
+	}
+}
+
+func TestUDPProxyMaxSessions(t *testing.T) {
+	srv := newTestServer(t, 1, echoUDP(t), server.HealthCheckNone)
+	p, addr := startUDPProxy(t, config.UDPConfig{Name: "test", MaxSessions: 1}, srv)
+
+	if exchange(t, udpClient(t, addr), 5*time.Second) == "" {
+		t.Fatal("no reply for the first client")
+	}
+	// новый клиент сверх лимита отбрасывается, существующая сессия не вытесняется
+	if reply := exchange(t, udpClient(t, addr), 200*time.Millisecond); reply != "" {
+		t.Fatalf("expected datagram over session limit to be dropped, got reply %q", reply)
+	}
+	if n := sessionCount(p); n != 1 {
+		t.Fatalf("expected 1 session, got %d", n)
+	}
+
+	client := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}
+	if _, err := p.session(client); err != ErrTooManySessions {
+		t.Fatalf("expected ErrTooManySessions, got %v", err)
+	}
+}
+
+func TestUDPProxySessionTimeout(t *testing.T) {
+	srv := newTestServer(t, 1, echoUDP(t), server.HealthCheckNone)
+	p, addr := startUDPProxy(t, config.UDPConfig{
+		Name:           "test",
+		SessionTimeout: config.Duration{Duration: 100 * time.Millisecond},
+	}, srv)
+
+	if exchange(t, udpClient(t, addr), 5*time.Second) == "" {
+		t.Fatal("no reply from backend")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for sessionCount(p) != 0 || srv.ActiveConns() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("session did not expire: %d sessions, %d active", sessionCount(p), srv.ActiveConns())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,61 @@
+package balancer
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isUpgrade проверяет, запрашивает ли клиент смену протокола (WebSocket и т.п.)
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// idleResponseWriter при захвате соединения (Hijack) оборачивает его таймаутом простоя
+type idleResponseWriter struct {
+	http.ResponseWriter
+	timeout time.Duration
+}
+
+func (w *idleResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn = &idleConn{Conn: conn, timeout: w.timeout}
+	conn.SetDeadline(time.Now().Add(w.timeout))
+	return conn, rw, nil
+}
+
+func (w *idleResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// idleConn закрывается, если в обе стороны нет данных дольше timeout:
+// каждое чтение и запись продлевают срок соединения
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
@@ -0,0 +1,117 @@
+package balancer
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		upgrade    string
+		connection []string
+		want       bool
+	}{
+		{"websocket", "websocket", []string{"Upgrade"}, true},
+		{"token list", "websocket", []string{"keep-alive, upgrade"}, true},
+		{"second header", "websocket", []string{"keep-alive", "Upgrade"}, true},
+		{"without connection", "websocket", nil, false},
+		{"without upgrade", "", []string{"Upgrade"}, false},
+		{"keep-alive", "websocket", []string{"keep-alive"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.upgrade != "" {
+				r.Header.Set("Upgrade", tt.upgrade)
+			}
+			for _, value := range tt.connection {
+				r.Header.Add("Connection", value)
+			}
+			if got := isUpgrade(r); got != tt.want {
+				t.Fatalf("isUpgrade = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// echoUpgrade - бэкенд, который после 101 Switching Protocols возвращает полученные данные
+var echoUpgrade = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+	rw.Flush()
+	io.Copy(conn, rw)
+})
+
+// dialUpgrade открывает соединение через балансировщик и выполняет смену протокола
+func dialUpgrade(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: lb\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	return conn, br
+}
+
+func TestUpgradeIdleTimeout(t *testing.T) {
+	b := newTestPool(t, echoUpgrade)
+	b.SetUpgradeIdleTimeout(300 * time.Millisecond)
+	front := httptest.NewServer(b)
+	defer front.Close()
+
+	conn, br := dialUpgrade(t, front.Listener.Addr().String())
+	// обмен данными продлевает соединение дольше таймаута простоя
+	buf := make([]byte, 4)
+	for range 4 {
+		time.Sleep(150 * time.Millisecond)
+		conn.Write([]byte("ping"))
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("echo = %q, err = %v", buf, err)
+		}
+	}
+
+	// без данных соединение закрывается балансировщиком
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("err = %v, want EOF", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("idle connection closed after %s", elapsed)
+	}
+}
+
+// без здоровых серверов смена протокола отклоняется, токены возвращаются
+func TestUpgradeNoHealthyServer(t *testing.T) {
+	b := newDeadPool(t)
+	setTestLimits(t, b, 0)
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Connection", "Upgrade")
+	if rec := serve(b, r); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if got := remaining(b); got != 10 {
+		t.Fatalf("remaining = %d, want 10", got)
+	}
+}
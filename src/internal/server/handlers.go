@@ -3,23 +3,38 @@ package server
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // вспомогательная структура для создания запросов
 type TaskRequest struct {
-	DelayMs int `json:"delay_ms"`
+	DelayMs  int    `json:"delay_ms"`
+	Priority string `json:"priority"` // приоритет, выставленный балансировщиком (X-Priority)
 }
 
 // структура для отправки запросов на сервера от балансировщика
 type TaskResponse struct {
 	ServerID  int           `json:"server_id"`
 	Delay     time.Duration `json:"delay"`
+	Priority  string        `json:"priority,omitempty"`
 	Timestamp string        `json:"timestamp"`
 }
 
+// событие о ходе выполнения задачи в потоковом режиме
+type TaskProgress struct {
+	ServerID int `json:"server_id"`
+	DoneMs   int `json:"done_ms"`
+	TotalMs  int `json:"total_ms"`
+	Percent  int `json:"percent"`
+}
+
+// интервал отправки событий о ходе выполнения задачи
+const progressInterval = 250 * time.Millisecond
+
 // Переменные для уменьшения количества логов о состоянии сервера
 var (
 	logCounter  = 0
@@ -56,18 +71,20 @@ func (s *Server) handleProcessTask(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return
 		}
-		req := TaskRequest{DelayMs: execTime}
+		req := TaskRequest{DelayMs: execTime, Priority: r.Header.Get("X-Priority")}
 		// Логируем начало обработки
-		s.Logger.Printf("Server %d: Starting task with delay %dms", s.ID, req.DelayMs)
+		s.Logger.Printf("Server %d: Starting task with delay %dms, priority %q", s.ID, req.DelayMs, req.Priority)
+
+		// Потоковый режим: ход выполнения отправляется событиями SSE
+		if IsEventStream(r) {
+			s.streamTask(w, req)
+			return
+		}
 
 		// Имитируем обработку
 		processingTime := s.ProcessTask(time.Duration(req.DelayMs))
 		// Формируем ответ
-		resp := TaskResponse{
-			ServerID:  s.ID,
-			Delay:     processingTime,
-			Timestamp: time.Now().Format(time.Millisecond.String()),
-		}
+		resp := s.taskResponse(req, processingTime)
 
 		// Логируем завершение
 		s.Logger.Printf("Server %d: Task completed in %dms", s.ID, req.DelayMs)
@@ -79,6 +96,50 @@ func (s *Server) handleProcessTask(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// IsEventStream проверяет, ожидает ли клиент поток событий (Accept: text/event-stream)
+func IsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// выполнение задачи с отправкой событий progress во время обработки и result в конце
+func (s *Server) streamTask(w http.ResponseWriter, req TaskRequest) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	processingTime := s.ProcessTaskWithProgress(time.Duration(req.DelayMs), progressInterval/time.Millisecond,
+		func(done time.Duration) {
+			percent := 100
+			if req.DelayMs > 0 {
+				percent = int(done) * 100 / req.DelayMs
+			}
+			writeEvent(w, "progress", TaskProgress{ServerID: s.ID, DoneMs: int(done), TotalMs: req.DelayMs, Percent: percent})
+			rc.Flush()
+		})
+
+	writeEvent(w, "result", s.taskResponse(req, processingTime))
+	rc.Flush()
+	s.Logger.Printf("Server %d: Task completed in %dms (stream)", s.ID, req.DelayMs)
+}
+
+// запись события SSE с данными в JSON
+func writeEvent(w http.ResponseWriter, event string, data any) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+// формирование ответа о выполненной задаче
+func (s *Server) taskResponse(req TaskRequest, processingTime time.Duration) TaskResponse {
+	return TaskResponse{
+		ServerID:  s.ID,
+		Delay:     processingTime,
+		Priority:  req.Priority,
+		Timestamp: time.Now().Format(time.Millisecond.String()),
+	}
+}
+
 // хэндлер обрабатывающий запрос о состоянии сервера и возвращающий ответ балансировщику
 func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	// log.Printf("Received health check request from %s", r.RemoteAddr)
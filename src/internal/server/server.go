@@ -1,33 +1,58 @@
 package server
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pozedorum/load_balancer/config"
+	"github.com/pozedorum/load_balancer/pkg/grpcwire"
 	"github.com/pozedorum/load_balancer/pkg/logger"
+	"github.com/pozedorum/load_balancer/pkg/tlsutil"
 )
 
 const logDir = "logs"
 
+// Типы health check (поле health_check в конфиге сервера)
+const (
+	HealthCheckHTTP = "http" // GET /health должен вернуть 200
+	HealthCheckTCP  = "tcp"  // сервер должен принять TCP-соединение
+	HealthCheckNone = "none" // сервер всегда считается здоровым (например, UDP-сервис без TCP)
+	HealthCheckGRPC = "grpc" // grpc.health.v1.Health/Check должен вернуть SERVING
+)
+
+// таймаут health check
+const healthCheckTimeout = 2 * time.Second
+
 // server - структура сервера
 type Server struct {
-	ID      int          // Номер сервера в списке серверов балансировщика
-	URL     string       // Адрес сервера (например, "http://localhost:8081")
-	Client  *http.Client // HTTP-клиент для health check
-	Logger  *log.Logger  // Логгер
-	mu      sync.RWMutex // Мьютекс для защиты данных
-	Healthy bool         // Флаг здоровья
+	ID        int               // Номер сервера в списке серверов балансировщика
+	URL       string            // Адрес сервера (например, "http://localhost:8081")
+	Client    *http.Client      // HTTP-клиент для health check
+	Transport http.RoundTripper // транспорт для проксирования запросов (с настройками TLS бэкенда)
+	Addr      string            // адрес host:port для L4-режима и TCP health check
+	Health    string            // тип health check: http (по умолчанию), tcp, grpc или none
+	Service   string            // имя сервиса для gRPC health check (пустое - весь сервер)
+	Logger    *log.Logger       // Логгер
+	mu        sync.RWMutex      // Мьютекс для защиты данных
+	Healthy   bool              // Флаг здоровья
+	active    atomic.Int64      // количество проксируемых запросов и соединений
 }
 
 // Конструктор сервера со стороны балансировщика
 func New(port string) *Server {
 	id, err := strconv.Atoi(port)
 	if err != nil {
-		log.Fatalf("Error with loading server on port %s, error: %w", port, err)
+		log.Fatalf("Error with loading server on port %s, error: %v", port, err)
 	}
 	id -= 8080
 	return &Server{
@@ -38,11 +63,69 @@ func New(port string) *Server {
 	}
 }
 
+// Конструктор сервера со стороны балансировщика по настройкам из servers.json
+// (адрес, схема, протокол и TLS/mTLS до бэкенда, одинаковые для проксирования и health check)
+func NewFromConfig(cfg config.ServerConfig, transports *TransportPool) (*Server, error) {
+	host := cfg.Host
+	if host == "" {
+		host = "localhost"
+	}
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if cfg.TLS != nil {
+			scheme = "https"
+		}
+	}
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("server %d: unsupported scheme %q", cfg.ID, scheme)
+	}
+	health := cfg.HealthCheck
+	if health == "" {
+		health = HealthCheckHTTP
+	}
+	switch health {
+	case HealthCheckHTTP, HealthCheckTCP, HealthCheckGRPC, HealthCheckNone:
+	default:
+		return nil, fmt.Errorf("server %d: unsupported health check %q", cfg.ID, health)
+	}
+	// grpc.health.v1 работает только поверх HTTP/2
+	if health == HealthCheckGRPC && cfg.Protocol != ProtocolH2C && cfg.Protocol != ProtocolHTTP2 {
+		return nil, fmt.Errorf("server %d: grpc health check requires protocol h2c or h2", cfg.ID)
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+
+	var tlsConfig *tls.Config
+	if cfg.TLS != nil {
+		var err error
+		tlsConfig, err = tlsutil.NewClientConfig(cfg.TLS.CAFile, cfg.TLS.CertFile, cfg.TLS.KeyFile,
+			cfg.TLS.ServerName, cfg.TLS.InsecureSkipVerify)
+		if err != nil {
+			return nil, fmt.Errorf("server %d: %w", cfg.ID, err)
+		}
+	}
+	transport, err := transports.Get(cfg.Protocol, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("server %d: %w", cfg.ID, err)
+	}
+
+	return &Server{
+		ID:        cfg.ID,
+		Healthy:   true,
+		URL:       (&url.URL{Scheme: scheme, Host: addr}).String(),
+		Client:    &http.Client{Timeout: healthCheckTimeout, Transport: transport},
+		Transport: transport,
+		Addr:      addr,
+		Health:    health,
+		Service:   cfg.GRPCService,
+	}, nil
+}
+
 // Конструктор сервера со стороны сервера
 func NewWithLogger(port string, logger *logger.Logger) *Server {
 	id, err := strconv.Atoi(port)
 	if err != nil {
-		log.Fatalf("Error with loading server on port %s, error: %w", port, err)
+		log.Fatalf("Error with loading server on port %s, error: %v", port, err)
 	}
 	id -= 8080
 	return &Server{
@@ -65,6 +148,15 @@ func CreateServers(count int) []*Server {
 
 // отправка запроса на проверку состояния сервера и обработка ответа
 func (s *Server) CheckHealth() (int, error) {
+	switch s.Health {
+	case HealthCheckTCP:
+		return 0, s.checkTCP()
+	case HealthCheckGRPC:
+		return s.checkGRPC()
+	case HealthCheckNone:
+		return 0, nil
+	}
+
 	resp, err := s.Client.Get(s.URL + "/health")
 	if err != nil {
 		s.setHealthy(false)
@@ -83,6 +175,75 @@ func (s *Server) CheckHealth() (int, error) {
 	return resp.StatusCode, nil
 }
 
+// проверка состояния установкой TCP-соединения
+func (s *Server) checkTCP() error {
+	conn, err := net.DialTimeout("tcp", s.Addr, healthCheckTimeout)
+	if err != nil {
+		s.setHealthy(false)
+		log.Printf("Server %d TCP health check failed: %v", s.ID, err)
+		return err
+	}
+	conn.Close()
+	s.setHealthy(true)
+	return nil
+}
+
+// статус SERVING в ответе grpc.health.v1
+const grpcServing = 1
+
+// проверка состояния по протоколу grpc.health.v1 (требуется HTTP/2: protocol h2c или h2)
+func (s *Server) checkGRPC() (int, error) {
+	status, err := s.grpcHealth()
+	if err != nil {
+		s.setHealthy(false)
+		log.Printf("Server %d gRPC health check failed: %v", s.ID, err)
+		return status, err
+	}
+	s.setHealthy(true)
+	return status, nil
+}
+
+// вызов grpc.health.v1.Health/Check, ошибка - если сервис не в статусе SERVING
+func (s *Server) grpcHealth() (int, error) {
+	body := grpcwire.EncodeFrame(grpcwire.AppendString(nil, 1, s.Service)) // HealthCheckRequest.service
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/grpc.health.v1.Health/Check", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	msg, frameErr := grpcwire.ReadFrame(resp.Body)
+	io.Copy(io.Discard, resp.Body) // trailers доступны после чтения тела
+	code, message, err := grpcwire.Status(resp)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if code != grpcwire.OK {
+		return resp.StatusCode, fmt.Errorf("grpc status %d: %s", code, message)
+	}
+	if frameErr != nil {
+		return resp.StatusCode, frameErr
+	}
+	serving, _, err := grpcwire.VarintField(msg, 1) // HealthCheckResponse.status
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if serving != grpcServing {
+		return resp.StatusCode, fmt.Errorf("service is not serving (status %d)", serving)
+	}
+	return resp.StatusCode, nil
+}
+
 // // функция установки статуса с блокировкой данных
 func (s *Server) setHealthy(health bool) {
 	s.mu.Lock() // полная блокировка
@@ -103,3 +264,27 @@ func (s *Server) ProcessTask(delay time.Duration) time.Duration {
 	time.Sleep(delay * time.Millisecond)
 	return delay
 }
+
+// Обработка задачи с вызовом progress после каждого шага (задержки в миллисекундах)
+func (s *Server) ProcessTaskWithProgress(delay, step time.Duration, progress func(done time.Duration)) time.Duration {
+	for done := time.Duration(0); done < delay; {
+		next := min(step, delay-done)
+		time.Sleep(next * time.Millisecond)
+		done += next
+		progress(done)
+	}
+	return delay
+}
+
+// ActiveConns возвращает количество запросов и соединений, проксируемых на сервер
+func (s *Server) ActiveConns() int64 {
+	return s.active.Load()
+}
+
+// TrackConn учитывает проксируемый запрос или соединение,
+// возвращённую функцию нужно вызвать после его завершения
+func (s *Server) TrackConn() (done func()) {
+	s.active.Add(1)
+	var once sync.Once
+	return func() { once.Do(func() { s.active.Add(-1) }) }
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ServerConfig
+		url     string
+		health  string
+		wantErr bool
+	}{
+		{"defaults", config.ServerConfig{ID: 1, Port: 8081}, "http://localhost:8081", HealthCheckHTTP, false},
+		{"host and scheme", config.ServerConfig{ID: 1, Host: "10.0.0.1", Port: 443, Scheme: "https"}, "https://10.0.0.1:443", HealthCheckHTTP, false},
+		{"ipv6 host", config.ServerConfig{ID: 1, Host: "::1", Port: 8081}, "http://[::1]:8081", HealthCheckHTTP, false},
+		{"grpc over h2c", config.ServerConfig{ID: 1, Port: 50051, Protocol: ProtocolH2C, HealthCheck: HealthCheckGRPC}, "http://localhost:50051", HealthCheckGRPC, false},
+		{"grpc over h2", config.ServerConfig{ID: 1, Port: 50051, Scheme: "https", Protocol: ProtocolHTTP2, HealthCheck: HealthCheckGRPC}, "https://localhost:50051", HealthCheckGRPC, false},
+		{"grpc over http1", config.ServerConfig{ID: 1, Port: 50051, HealthCheck: HealthCheckGRPC}, "", "", true},
+		{"grpc over explicit http1", config.ServerConfig{ID: 1, Port: 50051, Protocol: ProtocolHTTP1, HealthCheck: HealthCheckGRPC}, "", "", true},
+		{"unknown health check", config.ServerConfig{ID: 1, Port: 8081, HealthCheck: "icmp"}, "", "", true},
+		{"unknown scheme", config.ServerConfig{ID: 1, Port: 8081, Scheme: "ftp"}, "", "", true},
+		{"unknown protocol", config.ServerConfig{ID: 1, Port: 8081, Protocol: "h3"}, "", "", true},
+	}
+	transports := NewTransportPool(config.UpstreamConfig{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := NewFromConfig(tt.cfg, transports)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if srv.URL != tt.url || srv.Health != tt.health {
+				t.Fatalf("server = (%s, %s), want (%s, %s)", srv.URL, srv.Health, tt.url, tt.health)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// testCert - самоподписанный сертификат, записанный в файлы
+type testCert struct {
+	certFile, keyFile string
+	cert              tls.Certificate
+	pool              *x509.CertPool // пул с этим сертификатом в качестве CA
+}
+
+// writeCert создаёт самоподписанный сертификат для имени cn (и 127.0.0.1) и записывает пару в dir
+func writeCert(t *testing.T, dir, name, cn string) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testCert{
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(c.certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c.keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if c.cert, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	c.pool = x509.NewCertPool()
+	c.pool.AppendCertsFromPEM(certPEM)
+	return c
+}
+
+// startMTLSBackend запускает HTTPS-бэкенд, требующий клиентский сертификат, подписанный clientCA
+func startMTLSBackend(t *testing.T, serverCert testCert, clientCA *x509.CertPool) (host string, port int) {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCA,
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	h, p, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ = strconv.Atoi(p)
+	return h, port
+}
+
+func TestBackendMTLS(t *testing.T) {
+	dir := t.TempDir()
+	backendCert := writeCert(t, dir, "backend", "backend.test")
+	clientCert := writeCert(t, dir, "client", "balancer.test")
+	otherCert := writeCert(t, dir, "other", "other.test")
+	host, port := startMTLSBackend(t, backendCert, clientCert.pool)
+
+	tests := []struct {
+		name    string
+		tls     config.BackendTLSConfig
+		healthy bool
+	}{
+		{"client certificate", config.BackendTLSConfig{CAFile: backendCert.certFile,
+			CertFile: clientCert.certFile, KeyFile: clientCert.keyFile}, true},
+		{"server name", config.BackendTLSConfig{CAFile: backendCert.certFile,
+			CertFile: clientCert.certFile, KeyFile: clientCert.keyFile, ServerName: "backend.test"}, true},
+		{"insecure skip verify", config.BackendTLSConfig{InsecureSkipVerify: true,
+			CertFile: clientCert.certFile, KeyFile: clientCert.keyFile}, true},
+		{"no client certificate", config.BackendTLSConfig{CAFile: backendCert.certFile}, false},
+		{"untrusted client certificate", config.BackendTLSConfig{CAFile: backendCert.certFile,
+			CertFile: otherCert.certFile, KeyFile: otherCert.keyFile}, false},
+		{"untrusted backend", config.BackendTLSConfig{CAFile: otherCert.certFile,
+			CertFile: clientCert.certFile, KeyFile: clientCert.keyFile}, false},
+		{"wrong server name", config.BackendTLSConfig{CAFile: backendCert.certFile,
+			CertFile: clientCert.certFile, KeyFile: clientCert.keyFile, ServerName: "other.test"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backendTLS := tt.tls
+			srv, err := NewFromConfig(config.ServerConfig{ID: 1, Host: host, Port: port, TLS: &backendTLS},
+				NewTransportPool(config.UpstreamConfig{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// схема по умолчанию при заданном TLS - https
+			if want := "https://" + net.JoinHostPort(host, strconv.Itoa(port)); srv.URL != want {
+				t.Fatalf("URL = %s, want %s", srv.URL, want)
+			}
+			srv.CheckHealth()
+			if srv.IsHealthy() != tt.healthy {
+				t.Fatalf("healthy = %v, want %v", srv.IsHealthy(), tt.healthy)
+			}
+		})
+	}
+}
+
+func TestBackendTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	cert := writeCert(t, dir, "client", "balancer.test")
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		tls  config.BackendTLSConfig
+	}{
+		{"missing ca file", config.BackendTLSConfig{CAFile: filepath.Join(dir, "missing.crt")}},
+		{"ca without certificates", config.BackendTLSConfig{CAFile: notPEM}},
+		{"certificate without key", config.BackendTLSConfig{CertFile: cert.certFile}},
+		{"invalid key", config.BackendTLSConfig{CertFile: cert.certFile, KeyFile: notPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backendTLS := tt.tls
+			_, err := NewFromConfig(config.ServerConfig{ID: 1, Port: 8443, TLS: &backendTLS},
+				NewTransportPool(config.UpstreamConfig{}))
+			if err == nil {
+				t.Fatal("expected error for invalid backend TLS settings")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// Протоколы соединения с бэкендом (поле protocol в servers.json)
+const (
+	ProtocolHTTP1 = "http1" // HTTP/1.1 (по умолчанию), для https возможен HTTP/2 через ALPN
+	ProtocolHTTP2 = "h2"    // HTTP/2 поверх TLS
+	ProtocolH2C   = "h2c"   // HTTP/2 без шифрования (prior knowledge)
+)
+
+// TransportPool выдаёт транспорты для бэкендов. Бэкенды без собственных настроек TLS
+// с одинаковым протоколом используют один общий транспорт, поэтому соединения
+// переиспользуются, а настройки пула соединений задаются в одном месте.
+type TransportPool struct {
+	cfg    config.UpstreamConfig
+	mu     sync.Mutex
+	shared map[string]*http.Transport // общие транспорты по протоколу
+}
+
+// NewTransportPool создает пул транспортов с настройками из конфига
+func NewTransportPool(cfg config.UpstreamConfig) *TransportPool {
+	return &TransportPool{
+		cfg:    cfg,
+		shared: make(map[string]*http.Transport),
+	}
+}
+
+// Get возвращает транспорт для протокола. Если задан tlsConfig, создается отдельный транспорт.
+func (p *TransportPool) Get(protocol string, tlsConfig *tls.Config) (*http.Transport, error) {
+	if protocol == "" {
+		protocol = ProtocolHTTP1
+	}
+	if tlsConfig != nil {
+		return p.newTransport(protocol, tlsConfig)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if transport, ok := p.shared[protocol]; ok {
+		return transport, nil
+	}
+	transport, err := p.newTransport(protocol, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.shared[protocol] = transport
+	return transport, nil
+}
+
+// newTransport создает транспорт с настройками пула соединений и таймаутов
+func (p *TransportPool) newTransport(protocol string, tlsConfig *tls.Config) (*http.Transport, error) {
+	cfg := p.cfg
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   durationOr(cfg.DialTimeout, 5*time.Second),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          intOr(cfg.MaxIdleConns, 256),
+		MaxIdleConnsPerHost:   intOr(cfg.MaxIdleConnsPerHost, 64),
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       durationOr(cfg.IdleConnTimeout, 90*time.Second),
+		TLSHandshakeTimeout:   durationOr(cfg.TLSHandshakeTimeout, 5*time.Second),
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout.Duration,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	var protocols http.Protocols
+	switch protocol {
+	case ProtocolHTTP1:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true) // для https бэкенд может выбрать HTTP/2 через ALPN
+	case ProtocolHTTP2:
+		protocols.SetHTTP2(true)
+	case ProtocolH2C:
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("unsupported backend protocol %q", protocol)
+	}
+	transport.Protocols = &protocols
+	return transport, nil
+}
+
+// intOr возвращает значение или значение по умолчанию, если оно не задано
+func intOr(value, def int) int {
+	if value > 0 {
+		return value
+	}
+	return def
+}
+
+// durationOr возвращает длительность или значение по умолчанию, если она не задана
+func durationOr(value config.Duration, def time.Duration) time.Duration {
+	if value.Duration > 0 {
+		return value.Duration
+	}
+	return def
+}
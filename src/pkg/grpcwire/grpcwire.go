@@ -0,0 +1,178 @@
+package grpcwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Минимальная поддержка gRPC поверх HTTP/2 без внешних зависимостей:
+// определение вызовов, статусы, кадры сообщений и простейшие поля protobuf.
+
+var (
+	ErrFrameTooLarge = errors.New("grpc message is too large")
+	ErrCompressed    = errors.New("compressed grpc messages are not supported")
+	ErrInvalidVarint = errors.New("invalid protobuf varint")
+)
+
+// максимальный размер сообщения
+const MaxMessageSize = 4 << 20
+
+// Code - код статуса gRPC
+type Code int
+
+const (
+	OK                Code = 0
+	Unknown           Code = 2
+	PermissionDenied  Code = 7
+	ResourceExhausted Code = 8
+	Unimplemented     Code = 12
+	Internal          Code = 13
+	Unavailable       Code = 14
+	Unauthenticated   Code = 16
+)
+
+// IsGRPC проверяет, является ли запрос вызовом gRPC
+func IsGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// FromHTTPStatus сопоставляет HTTP-статус ошибки коду gRPC
+func FromHTTPStatus(status int) Code {
+	switch status {
+	case http.StatusOK:
+		return OK
+	case http.StatusBadRequest:
+		return Internal
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return Unimplemented
+	case http.StatusTooManyRequests:
+		return ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return Unavailable
+	default:
+		return Unknown
+	}
+}
+
+// SetStatus записывает статус в заголовки (ответ trailers-only)
+func SetStatus(h http.Header, code Code, message string) {
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		h.Set("Grpc-Message", url.PathEscape(message))
+	}
+}
+
+// WriteError отправляет ошибку вызова: HTTP 200 со статусом gRPC и без тела
+func WriteError(w http.ResponseWriter, code Code, message string) {
+	SetStatus(w.Header(), code, message)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Status возвращает статус gRPC ответа из trailers или, для trailers-only ответа, из заголовков
+func Status(resp *http.Response) (Code, string, error) {
+	value, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if value == "" {
+		value, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if value == "" {
+		return Unknown, "", errors.New("grpc-status is missing")
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return Unknown, "", fmt.Errorf("invalid grpc-status %q", value)
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	return Code(code), message, nil
+}
+
+// EncodeFrame упаковывает сообщение в кадр: флаг сжатия (0) и длина (4 байта big-endian)
+func EncodeFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// ReadFrame читает одно несжатое сообщение
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, ErrCompressed
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxMessageSize {
+		return nil, ErrFrameTooLarge
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AppendString добавляет в сообщение protobuf строковое поле (пустая строка не кодируется)
+func AppendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// VarintField возвращает значение поля-числа (enum, int) сообщения protobuf,
+// ok=false если поля нет (значение по умолчанию 0)
+func VarintField(msg []byte, field int) (value uint64, ok bool, err error) {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, false, ErrInvalidVarint
+		}
+		msg = msg[n:]
+		switch tag & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, false, ErrInvalidVarint
+			}
+			msg = msg[n:]
+			if int(tag>>3) == field {
+				value, ok = v, true
+			}
+		case 1: // 64 бита
+			if len(msg) < 8 {
+				return 0, false, io.ErrUnexpectedEOF
+			}
+			msg = msg[8:]
+		case 2: // строка, байты, вложенное сообщение
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return 0, false, ErrInvalidVarint
+			}
+			msg = msg[n+int(size):]
+		case 5: // 32 бита
+			if len(msg) < 4 {
+				return 0, false, io.ErrUnexpectedEOF
+			}
+			msg = msg[4:]
+		default:
+			return 0, false, fmt.Errorf("unsupported protobuf wire type %d", tag&7)
+		}
+	}
+	return value, ok, nil
+}
@@ -0,0 +1,172 @@
+package grpcwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, msg := range [][]byte{nil, []byte("hello"), bytes.Repeat([]byte{1}, 1000)} {
+		buf.Write(EncodeFrame(msg))
+	}
+	for _, want := range []int{0, 5, 1000} {
+		msg, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msg) != want {
+			t.Fatalf("len = %d, want %d", len(msg), want)
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Fatalf("err = %v, want EOF", err)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	large := make([]byte, 5)
+	binary.BigEndian.PutUint32(large[1:], MaxMessageSize+1)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{"compressed", []byte{1, 0, 0, 0, 1, 'a'}, ErrCompressed},
+		{"too large", large, ErrFrameTooLarge},
+		{"short header", []byte{0, 0}, io.ErrUnexpectedEOF},
+		{"short message", []byte{0, 0, 0, 0, 3, 'a'}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadFrame(bytes.NewReader(tt.input)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVarintField(t *testing.T) {
+	// поле 1 - строка, поле 2 - число 300, поле 3 - fixed32, поле 4 - fixed64
+	msg := AppendString(nil, 1, "service")
+	msg = binary.AppendUvarint(msg, 2<<3|0)
+	msg = binary.AppendUvarint(msg, 300)
+	msg = append(msg, 3<<3|5, 0, 0, 0, 0)
+	msg = append(msg, 4<<3|1, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		field   int
+		value   uint64
+		ok      bool
+		wantErr bool
+	}{
+		{"present", msg, 2, 300, true, false},
+		{"absent", msg, 5, 0, false, false},
+		{"empty message", nil, 1, 0, false, false},
+		{"empty string not encoded", AppendString(nil, 1, ""), 1, 0, false, false},
+		{"truncated string", msg[:4], 2, 0, false, true},
+		{"truncated fixed32", []byte{3<<3 | 5, 0}, 2, 0, false, true},
+		{"bad varint", []byte{2 << 3, 0x80}, 2, 0, false, true},
+		{"unsupported wire type", []byte{2<<3 | 3}, 2, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok, err := VarintField(tt.msg, tt.field)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if value != tt.value || ok != tt.ok {
+				t.Fatalf("got (%d, %v), want (%d, %v)", value, ok, tt.value, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFromHTTPStatus(t *testing.T) {
+	tests := map[int]Code{
+		http.StatusOK:                  OK,
+		http.StatusBadRequest:          Internal,
+		http.StatusUnauthorized:        Unauthenticated,
+		http.StatusForbidden:           PermissionDenied,
+		http.StatusNotFound:            Unimplemented,
+		http.StatusTooManyRequests:     ResourceExhausted,
+		http.StatusBadGateway:          Unavailable,
+		http.StatusServiceUnavailable:  Unavailable,
+		http.StatusGatewayTimeout:      Unavailable,
+		http.StatusInternalServerError: Unknown,
+	}
+	for status, want := range tests {
+		if got := FromHTTPStatus(status); got != want {
+			t.Errorf("FromHTTPStatus(%d) = %d, want %d", status, got, want)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		trailer http.Header
+		code    Code
+		message string
+		wantErr bool
+	}{
+		{"trailers", http.Header{}, http.Header{"Grpc-Status": {"0"}}, OK, "", false},
+		{"trailers-only", http.Header{"Grpc-Status": {"14"}, "Grpc-Message": {"no%20backend"}}, http.Header{}, Unavailable, "no backend", false},
+		{"trailers win", http.Header{"Grpc-Status": {"14"}}, http.Header{"Grpc-Status": {"5"}}, 5, "", false},
+		{"missing", http.Header{}, http.Header{}, Unknown, "", true},
+		{"invalid", http.Header{"Grpc-Status": {"x"}}, http.Header{}, Unknown, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, message, err := Status(&http.Response{Header: tt.header, Trailer: tt.trailer})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if code != tt.code || message != tt.message {
+				t.Fatalf("got (%d, %q), want (%d, %q)", code, message, tt.code, tt.message)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, ResourceExhausted, "rate limit exceeded")
+
+	resp := rec.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	code, message, err := Status(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != ResourceExhausted || message != "rate limit exceeded" {
+		t.Fatalf("got (%d, %q)", code, message)
+	}
+}
+
+func TestIsGRPC(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+	r.Header.Set("Content-Type", "application/grpc+proto")
+	if IsGRPC(r) {
+		t.Fatal("HTTP/1.1 request is detected as gRPC")
+	}
+	r.ProtoMajor = 2
+	if !IsGRPC(r) {
+		t.Fatal("HTTP/2 application/grpc request is not detected")
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if IsGRPC(r) {
+		t.Fatal("JSON request is detected as gRPC")
+	}
+}
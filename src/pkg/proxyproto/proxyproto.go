@@ -0,0 +1,225 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoHeader       = errors.New("proxy protocol header not found")
+	ErrInvalidHeader  = errors.New("invalid proxy protocol header")
+	ErrUnsupportedV2  = errors.New("unsupported proxy protocol v2 address family")
+	signatureV2       = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	signatureV1       = []byte("PROXY ")
+	maxV1HeaderLength = 107
+)
+
+// время на чтение заголовка по умолчанию
+const DefaultHeaderTimeout = 5 * time.Second
+
+// Listener принимает соединения с заголовком HAProxy PROXY protocol (v1 и v2).
+// Заголовок разбирается только у соединений от доверенных адресов (для них он обязателен),
+// остальные соединения передаются как есть.
+type Listener struct {
+	net.Listener
+	Trusted       func(addr net.Addr) bool // проверка доверенного источника, nil - доверять всем
+	HeaderTimeout time.Duration            // таймаут на чтение заголовка
+}
+
+// NewListener оборачивает listener разбором PROXY protocol
+func NewListener(l net.Listener, trusted func(addr net.Addr) bool) *Listener {
+	return &Listener{
+		Listener:      l,
+		Trusted:       trusted,
+		HeaderTimeout: DefaultHeaderTimeout,
+	}
+}
+
+// Accept принимает соединение. Заголовок читается лениво при первом обращении
+// к соединению, чтобы медленный клиент не блокировал цикл Accept сервера.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.Trusted != nil && !l.Trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: l.HeaderTimeout,
+	}, nil
+}
+
+// Conn - соединение, адреса которого берутся из заголовка PROXY protocol
+type Conn struct {
+	net.Conn
+	reader     *bufio.Reader // буфер, из которого читается заголовок и данные
+	timeout    time.Duration // таймаут на чтение заголовка
+	once       sync.Once     // заголовок читается один раз
+	headerErr  error         // ошибка разбора заголовка
+	remoteAddr net.Addr      // адрес клиента из заголовка
+	localAddr  net.Addr      // адрес назначения из заголовка
+}
+
+// Read читает данные после заголовка
+func (c *Conn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr возвращает адрес клиента из заголовка (или адрес соединения для LOCAL/UNKNOWN)
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr возвращает адрес назначения из заголовка
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readHeader читает и разбирает заголовок, при ошибке соединение закрывается
+func (c *Conn) readHeader() {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+	}
+	c.remoteAddr, c.localAddr, c.headerErr = ReadHeader(c.reader)
+	if c.headerErr != nil {
+		c.Conn.Close()
+	}
+}
+
+// ReadHeader читает заголовок PROXY protocol v1 или v2 и возвращает адреса источника и назначения.
+// Для команд LOCAL (v2) и UNKNOWN (v1) адреса равны nil.
+func ReadHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	prefix, err := r.Peek(len(signatureV1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrNoHeader, err)
+	}
+	if bytes.Equal(prefix, signatureV1) {
+		return readV1(r)
+	}
+	prefix, err = r.Peek(len(signatureV2))
+	if err == nil && bytes.Equal(prefix, signatureV2) {
+		return readV2(r)
+	}
+	return nil, nil, ErrNoHeader
+}
+
+// readV1 разбирает текстовый заголовок: "PROXY TCP4 src dst sport dport\r\n"
+func readV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < maxV1HeaderLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidHeader
+	}
+	src, err := tcpAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := tcpAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+// tcpAddr собирает адрес из строковых IP и порта
+func tcpAddr(ip, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	parsedPort, err := strconv.Atoi(port)
+	if parsedIP == nil || err != nil || parsedPort < 0 || parsedPort > 65535 {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: parsedIP, Port: parsedPort}, nil
+}
+
+// readV2 разбирает бинарный заголовок
+func readV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+	verCmd, family := header[12], header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	if verCmd>>4 != 2 {
+		return nil, nil, ErrInvalidHeader
+	}
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL - соединение самого прокси (например, health check)
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+
+	var ipLen int
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	case 0x0: // AF_UNSPEC
+		return nil, nil, nil
+	default:
+		return nil, nil, ErrUnsupportedV2
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, ErrInvalidHeader
+	}
+	srcIP := net.IP(payload[:ipLen])
+	dstIP := net.IP(payload[ipLen : 2*ipLen])
+	srcPort := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+
+	// оставшаяся часть (TLV) не используется
+	if family&0x0f == 0x2 { // DGRAM
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}, nil
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+}
@@ -0,0 +1,148 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// заголовок v2 с командой cmd, семейством family и адресами в payload
+func headerV2(cmd, family byte, payload []byte) []byte {
+	h := append([]byte(nil), signatureV2...)
+	h = append(h, 0x20|cmd, family)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(payload)))
+	return append(h, payload...)
+}
+
+// адреса и порты в формате v2
+func addrsV2(src, dst net.IP, srcPort, dstPort uint16) []byte {
+	b := append(append([]byte(nil), src...), dst...)
+	b = binary.BigEndian.AppendUint16(b, srcPort)
+	return binary.BigEndian.AppendUint16(b, dstPort)
+}
+
+func TestReadHeader(t *testing.T) {
+	v4 := addrsV2(net.ParseIP("192.0.2.1").To4(), net.ParseIP("192.0.2.2").To4(), 5000, 80)
+	v6 := addrsV2(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 5000, 443)
+
+	tests := []struct {
+		name    string
+		input   []byte
+		src     string // "" - адреса нет
+		dst     string
+		wantErr error
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 5000 80\r\n"), "192.0.2.1:5000", "192.0.2.2:80", nil},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 5000 443\r\n"), "[2001:db8::1]:5000", "[2001:db8::2]:443", nil},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", "", nil},
+		{"v1 without crlf", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 5000 80\n"), "", "", ErrInvalidHeader},
+		{"v1 bad address", []byte("PROXY TCP4 999.0.2.1 192.0.2.2 5000 80\r\n"), "", "", ErrInvalidHeader},
+		{"v1 bad port", []byte("PROXY TCP4 192.0.2.1 192.0.2.2 70000 80\r\n"), "", "", ErrInvalidHeader},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), "", "", ErrInvalidHeader},
+		{"v2 tcp4", headerV2(0x1, 0x11, v4), "192.0.2.1:5000", "192.0.2.2:80", nil},
+		{"v2 tcp6", headerV2(0x1, 0x21, v6), "[2001:db8::1]:5000", "[2001:db8::2]:443", nil},
+		{"v2 udp4", headerV2(0x1, 0x12, v4), "192.0.2.1:5000", "192.0.2.2:80", nil},
+		{"v2 with tlv", headerV2(0x1, 0x11, append(v4, 0x04, 0x00, 0x01, 0xff)), "192.0.2.1:5000", "192.0.2.2:80", nil},
+		{"v2 local", headerV2(0x0, 0x00, nil), "", "", nil},
+		{"v2 unspec", headerV2(0x1, 0x00, nil), "", "", nil},
+		{"v2 unix", headerV2(0x1, 0x31, make([]byte, 216)), "", "", ErrUnsupportedV2},
+		{"v2 short payload", headerV2(0x1, 0x11, v4[:6]), "", "", ErrInvalidHeader},
+		{"v2 bad command", headerV2(0x2, 0x11, v4), "", "", ErrInvalidHeader},
+		{"v2 truncated", headerV2(0x1, 0x11, v4)[:20], "", "", ErrInvalidHeader},
+		{"no header", []byte("GET / HTTP/1.1\r\n\r\n"), "", "", ErrNoHeader},
+		{"empty", nil, "", "", ErrNoHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst, err := ReadHeader(bufio.NewReader(bytes.NewReader(tt.input)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := addrString(src); got != tt.src {
+				t.Fatalf("src = %q, want %q", got, tt.src)
+			}
+			if got := addrString(dst); got != tt.dst {
+				t.Fatalf("dst = %q, want %q", got, tt.dst)
+			}
+		})
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// данные после заголовка остаются в соединении, адрес клиента берётся из заголовка
+func TestListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	pl := NewListener(l, nil)
+
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 198.51.100.7 192.0.2.2 4000 80\r\nhello"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("data = %q, want %q", data, "hello")
+	}
+	if got := conn.RemoteAddr().String(); got != "198.51.100.7:4000" {
+		t.Fatalf("RemoteAddr = %s, want 198.51.100.7:4000", got)
+	}
+}
+
+// соединения от недоверенных адресов передаются без разбора заголовка
+func TestListenerUntrusted(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	pl := NewListener(l, func(net.Addr) bool { return false })
+
+	go func() {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("PROXY TCP4 198.51.100.7 192.0.2.2 4000 80\r\n"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, _ := io.ReadAll(conn)
+	if !strings.HasPrefix(string(data), "PROXY TCP4") {
+		t.Fatalf("data = %q, want header passed through", data)
+	}
+	if strings.HasPrefix(conn.RemoteAddr().String(), "198.51.100.7") {
+		t.Fatal("RemoteAddr is taken from the header of an untrusted connection")
+	}
+}
@@ -5,44 +5,55 @@ import (
 	"time"
 )
 
-// Bucket представляет собой bucket токенов для клиента
+// Bucket представляет собой bucket токенов для клиента.
+// Токены пополняются лениво: при каждом обращении количество токенов
+// пересчитывается по времени, прошедшему с последнего пополнения,
+// поэтому у bucket нет фоновых горутин и таймеров.
 type Bucket struct {
-	capacity int          // емкость bucket
-	rate     int          // скорость пополнения bucket
-	ticker   *time.Ticker // таймер автоматического пополнения бакетов
-	mu       sync.Mutex   // мьютекс защищающий данные(токены)
-	tokens   int          // текущее количество токенов в bucket
+	capacity   int        // емкость bucket
+	rate       float64    // скорость пополнения bucket (токенов в секунду)
+	mu         sync.Mutex // мьютекс защищающий данные(токены)
+	tokens     float64    // текущее количество токенов в bucket (может быть дробным)
+	lastRefill time.Time  // время последнего пересчёта токенов
 }
 
 // NewBucket создает новый bucket с заданными настройками
-func NewBucket(capacity, rate int) *Bucket {
-	b := &Bucket{
-		capacity: capacity,
-		rate:     rate,
-		tokens:   capacity,
-	}
-	b.ticker = time.NewTicker(time.Duration(rate) * time.Second)
-	go b.refillTokens()
-	return b
-}
-
-// refillTokens периодически пополняет токены в bucket
-func (b *Bucket) refillTokens() {
-	for range b.ticker.C {
-		b.mu.Lock()
-		if b.tokens < b.capacity {
-			b.tokens++
-		}
-		b.mu.Unlock()
+func NewBucket(capacity int, rate float64) *Bucket {
+	return &Bucket{
+		capacity:   capacity,
+		rate:       rate,
+		tokens:     float64(capacity),
+		lastRefill: time.Now(),
 	}
 }
 
+// refill пересчитывает количество токенов с учётом прошедшего времени,
+// вызывается под мьютексом
+func (b *Bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += elapsed * b.rate
+	if b.tokens > float64(b.capacity) {
+		b.tokens = float64(b.capacity)
+	}
+	b.lastRefill = now
+}
+
 // TakeToken извлекает токен из bucket, если он доступен
 func (b *Bucket) TakeToken() bool {
+	return b.TakeTokens(1)
+}
+
+// TakeTokens извлекает n токенов из bucket, если они доступны (не больше емкости)
+func (b *Bucket) TakeTokens(n int) bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if b.tokens > 0 {
-		b.tokens--
+	b.refill(time.Now())
+	n = clampCost(n, b.capacity)
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
 		return true
 	}
 	return false
@@ -50,10 +61,54 @@ func (b *Bucket) TakeToken() bool {
 
 // ReturnToken возвращает токен обратно в bucket
 func (b *Bucket) ReturnToken() {
+	b.ReturnTokens(1)
+}
+
+// ReturnTokens возвращает n токенов обратно в bucket
+func (b *Bucket) ReturnTokens(n int) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	b.refill(time.Now())
 	// Не превышаем максимальную емкость
-	if b.tokens < b.capacity {
-		b.tokens++
+	b.tokens += float64(clampCost(n, b.capacity))
+	if b.tokens > float64(b.capacity) {
+		b.tokens = float64(b.capacity)
+	}
+}
+
+// State возвращает оставшиеся токены и время до пополнения на запрос стоимостью n
+func (b *Bucket) State(n int) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	n = clampCost(n, b.capacity)
+
+	state := State{
+		Limit:     b.capacity,
+		Remaining: int(b.tokens),
+	}
+	if b.rate > 0 {
+		state.Reset = durationFromSeconds((float64(b.capacity) - b.tokens) / b.rate)
+		if b.tokens < float64(n) {
+			state.RetryAfter = durationFromSeconds((float64(n) - b.tokens) / b.rate)
+		}
+	}
+	return state
+}
+
+// Snapshot возвращает токены и время последнего пополнения
+func (b *Bucket) Snapshot() LimiterSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return LimiterSnapshot{Tokens: b.tokens, LastRefill: b.lastRefill}
+}
+
+// Restore восстанавливает токены, пополнение за время простоя произойдет при следующем обращении
+func (b *Bucket) Restore(s LimiterSnapshot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(max(s.Tokens, 0), float64(b.capacity))
+	if !s.LastRefill.IsZero() && s.LastRefill.Before(time.Now()) {
+		b.lastRefill = s.LastRefill
 	}
 }
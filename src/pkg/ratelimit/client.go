@@ -3,31 +3,177 @@ package ratelimit
 import (
 	"sync"
 	"time"
+
+	"github.com/pozedorum/load_balancer/config"
 )
 
-// Client представляет собой клиента с bucket токенов
+// Client представляет собой клиента с ограничителем запросов
 type Client struct {
-	ip       string       // адрес клиента
-	bucket   *Bucket      // бакет клиента
-	mu       sync.RWMutex // мьютекс защиты данных (lastSeen)
-	lastSeen time.Time    // время последней активности клиента
+	ip          string              // адрес клиента
+	mu          sync.RWMutex        // мьютекс защиты данных (ограничитель, lastSeen, бан)
+	limiter     Limiter             // ограничитель клиента (по умолчанию bucket токенов)
+	limits      config.ClientConfig // настройки, по которым создан ограничитель
+	lastSeen    time.Time           // время последней активности клиента
+	bannedUntil time.Time           // до какого времени клиент заблокирован
+	inFlight    int                 // количество выполняющихся запросов клиента
+}
+
+// ClientInfo - сведения о клиенте для admin API
+type ClientInfo struct {
+	Key         string              `json:"key"`
+	Limits      config.ClientConfig `json:"limits"`
+	Remaining   int                 `json:"remaining"`
+	Reset       config.Duration     `json:"reset"`
+	RetryAfter  config.Duration     `json:"retry_after"`
+	InFlight    int                 `json:"in_flight"`
+	LastSeen    time.Time           `json:"last_seen"`
+	BannedUntil *time.Time          `json:"banned_until,omitempty"`
 }
 
 // NewClient создает нового клиента с bucket токенов
-func NewClient(ip string, capacity, rate int) *Client {
+func NewClient(ip string, capacity int, rate float64) *Client {
+	client := NewClientWithLimiter(ip, NewBucket(capacity, rate))
+	client.limits = config.ClientConfig{Capacity: capacity, Rate: rate}
+	return client
+}
+
+// NewClientWithLimiter создает нового клиента с заданным ограничителем
+func NewClientWithLimiter(ip string, limiter Limiter) *Client {
 	return &Client{
-		ip:     ip,
-		bucket: NewBucket(capacity, rate),
+		ip:      ip,
+		limiter: limiter,
+	}
+}
+
+// newClientWithConfig создает клиента с ограничителем по настройкам
+func newClientWithConfig(ip string, cfg config.ClientConfig) (*Client, error) {
+	limiter, err := NewLimiter(cfg)
+	if err != nil {
+		return nil, err
 	}
+	client := NewClientWithLimiter(ip, limiter)
+	client.limits = cfg
+	return client, nil
 }
 
-// TakeToken извлекает токен из bucket клиента, если он доступен
+// TakeToken извлекает токен из ограничителя клиента, если он доступен
 func (c *Client) TakeToken() bool {
-	return c.bucket.TakeToken()
+	return c.TakeTokens(1)
+}
+
+// TakeTokens извлекает n токенов из ограничителя клиента, если они доступны
+func (c *Client) TakeTokens(n int) bool {
+	c.mu.RLock()
+	limiter, banned := c.limiter, c.isBanned(time.Now())
+	c.mu.RUnlock()
+	if banned {
+		return false
+	}
+	return limiter.TakeTokens(n)
 }
 
 func (c *Client) ReturnToken() {
-	c.bucket.ReturnToken()
+	c.ReturnTokens(1)
+}
+
+// ReturnTokens возвращает n токенов в ограничитель клиента
+func (c *Client) ReturnTokens(n int) {
+	c.mu.RLock()
+	limiter := c.limiter
+	c.mu.RUnlock()
+	limiter.ReturnTokens(n)
+}
+
+// State возвращает состояние лимита клиента для запроса стоимостью n,
+// у заблокированного клиента запросов не остаётся до конца бана
+func (c *Client) State(n int) State {
+	c.mu.RLock()
+	limiter, bannedUntil := c.limiter, c.bannedUntil
+	c.mu.RUnlock()
+
+	state := limiter.State(n)
+	if wait := time.Until(bannedUntil); wait > 0 {
+		state.Remaining = 0
+		state.RetryAfter = max(state.RetryAfter, wait)
+		state.Reset = max(state.Reset, wait)
+	}
+	return state
+}
+
+// SetLimiter заменяет ограничитель клиента (при изменении настроек или сбросе)
+func (c *Client) SetLimiter(limiter Limiter, cfg config.ClientConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limiter = limiter
+	c.limits = cfg
+}
+
+// Limits возвращает настройки ограничителя клиента
+func (c *Client) Limits() config.ClientConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.limits
+}
+
+// Acquire занимает слот выполняющегося запроса, если не превышен max_in_flight
+func (c *Client) Acquire() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.limits.MaxInFlight > 0 && c.inFlight >= c.limits.MaxInFlight {
+		return false
+	}
+	c.inFlight++
+	return true
+}
+
+// Release освобождает слот выполняющегося запроса
+func (c *Client) Release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight > 0 {
+		c.inFlight--
+	}
+}
+
+// Ban блокирует клиента до указанного времени
+func (c *Client) Ban(until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bannedUntil = until
+}
+
+// Unban снимает блокировку
+func (c *Client) Unban() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bannedUntil = time.Time{}
+}
+
+// isBanned проверяет блокировку, вызывается под мьютексом
+func (c *Client) isBanned(now time.Time) bool {
+	return now.Before(c.bannedUntil)
+}
+
+// Info собирает сведения о клиенте
+func (c *Client) Info() ClientInfo {
+	state := c.State(1)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	info := ClientInfo{
+		Key:        c.ip,
+		Limits:     c.limits,
+		Remaining:  state.Remaining,
+		Reset:      config.Duration{Duration: state.Reset},
+		RetryAfter: config.Duration{Duration: state.RetryAfter},
+		InFlight:   c.inFlight,
+		LastSeen:   c.lastSeen,
+	}
+	if c.isBanned(time.Now()) {
+		bannedUntil := c.bannedUntil
+		info.BannedUntil = &bannedUntil
+	}
+	return info
 }
 
 // Добавляем метод обновления времени последней активности
@@ -37,9 +183,11 @@ func (c *Client) UpdateLastSeen() {
 	c.lastSeen = time.Now()
 }
 
-// Добавляем метод проверки активности
+// Добавляем метод проверки активности (заблокированные клиенты и клиенты
+// с выполняющимися запросами считаются активными)
 func (c *Client) IsActive(timeout time.Duration) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return time.Since(c.lastSeen) < timeout
+	now := time.Now()
+	return now.Sub(c.lastSeen) < timeout || c.isBanned(now) || c.inFlight > 0
 }
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// ExecutionTimeHeader - заголовок с запрошенным временем выполнения задачи (в миллисекундах)
+const ExecutionTimeHeader = "Execution-Time"
+
+// CostFunc вычисляет стоимость запроса в токенах (не меньше 1)
+type CostFunc func(r *http.Request) int
+
+// NewCostFunc собирает функцию стоимости из правил: применяется первое правило,
+// подходящее по методу и префиксу пути, стоимость = tokens + ceil(время выполнения / per_execution_time).
+// Если ни одно правило не подошло, запрос стоит 1 токен.
+func NewCostFunc(rules []config.CostRule) CostFunc {
+	return func(r *http.Request) int {
+		for _, rule := range rules {
+			if !costRuleMatches(rule, r) {
+				continue
+			}
+			cost := rule.Tokens
+			if per := rule.PerExecutionTime.Duration; per > 0 {
+				cost += int(math.Ceil(float64(executionTime(r)) / float64(per)))
+			}
+			return max(cost, 1)
+		}
+		return 1
+	}
+}
+
+// costRuleMatches проверяет, подходит ли правило к запросу
+func costRuleMatches(rule config.CostRule, r *http.Request) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return false
+	}
+	return strings.HasPrefix(r.URL.Path, rule.Path)
+}
+
+// executionTime возвращает запрошенное время выполнения, некорректное значение считается нулевым
+// (такой запрос всё равно отклонит бэкенд)
+func executionTime(r *http.Request) time.Duration {
+	ms, err := strconv.Atoi(r.Header.Get(ExecutionTimeHeader))
+	if err != nil || ms < 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// GCRA (Generic Cell Rate Algorithm) хранит только теоретическое время
+// прибытия следующего запроса (TAT). Запросы равномерно распределяются
+// со скоростью rate, допускается всплеск не более burst запросов.
+type GCRA struct {
+	burst     int           // допустимый всплеск запросов
+	interval  time.Duration // интервал между запросами (1 / rate)
+	tolerance time.Duration // допустимое опережение графика (interval * burst)
+	mu        sync.Mutex    // мьютекс защиты tat
+	tat       time.Time     // теоретическое время прибытия
+}
+
+// NewGCRA создает ограничитель GCRA со скоростью rate запросов в секунду и всплеском burst
+func NewGCRA(burst int, rate float64) *GCRA {
+	// при rate больше 1e9 интервал округлился бы до нуля
+	interval := max(time.Duration(float64(time.Second)/rate), time.Nanosecond)
+	return &GCRA{
+		burst:     burst,
+		interval:  interval,
+		tolerance: interval * time.Duration(burst),
+	}
+}
+
+// TakeToken разрешает запрос, если он не опережает график больше чем на tolerance
+func (g *GCRA) TakeToken() bool {
+	return g.TakeTokens(1)
+}
+
+// TakeTokens разрешает запрос стоимостью n (не больше всплеска), график сдвигается на n интервалов
+func (g *GCRA) TakeTokens(n int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n = clampCost(n, g.burst)
+	now := time.Now()
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(g.interval * time.Duration(n))
+	if newTat.Sub(now) > g.tolerance {
+		return false
+	}
+	g.tat = newTat
+	return true
+}
+
+// ReturnToken откатывает график на один интервал
+func (g *GCRA) ReturnToken() {
+	g.ReturnTokens(1)
+}
+
+// ReturnTokens откатывает график на n интервалов
+func (g *GCRA) ReturnTokens(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	g.tat = g.tat.Add(-g.interval * time.Duration(clampCost(n, g.burst)))
+	if g.tat.Before(now) {
+		g.tat = now
+	}
+}
+
+// State возвращает доступный всплеск и время до запроса стоимостью n
+func (g *GCRA) State(n int) State {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n = clampCost(n, g.burst)
+	now := time.Now()
+
+	state := State{Limit: int(g.tolerance / g.interval)}
+	ahead := g.tat.Sub(now) // насколько график опережает текущее время
+	if ahead < 0 {
+		ahead = 0
+	}
+	state.Remaining = int((g.tolerance - ahead) / g.interval)
+	state.Reset = ahead
+	if wait := ahead + g.interval*time.Duration(n) - g.tolerance; wait > 0 {
+		state.RetryAfter = wait
+	}
+	return state
+}
+
+// Snapshot возвращает теоретическое время прибытия
+func (g *GCRA) Snapshot() LimiterSnapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return LimiterSnapshot{TAT: g.tat}
+}
+
+// Restore восстанавливает теоретическое время прибытия (не дальше допустимого опережения)
+func (g *GCRA) Restore(s LimiterSnapshot) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tat = s.TAT
+	if limit := time.Now().Add(g.tolerance); g.tat.After(limit) {
+		g.tat = limit
+	}
+}
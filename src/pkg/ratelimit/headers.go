@@ -0,0 +1,35 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WriteHeaders выставляет заголовки лимита в ответ:
+// RateLimit-* (IETF draft, Reset - секунды до восстановления)
+// и устаревшие X-RateLimit-* (Reset - Unix-время восстановления)
+func (s State) WriteHeaders(h http.Header) {
+	reset := ceilSeconds(s.Reset)
+	h.Set("RateLimit-Limit", strconv.Itoa(s.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(s.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("X-RateLimit-Limit", strconv.Itoa(s.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(s.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(s.Reset).Unix(), 10))
+}
+
+// WriteRetryAfter выставляет Retry-After для отклонённого запроса (не меньше 1 секунды)
+func (s State) WriteRetryAfter(h http.Header) {
+	retry := ceilSeconds(s.RetryAfter)
+	if retry < 1 {
+		retry = 1
+	}
+	h.Set("Retry-After", strconv.Itoa(retry))
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWriteHeaders(t *testing.T) {
+	h := http.Header{}
+	State{Limit: 10, Remaining: 3, Reset: 1500 * time.Millisecond}.WriteHeaders(h)
+
+	want := map[string]string{
+		"RateLimit-Limit":       "10",
+		"RateLimit-Remaining":   "3",
+		"RateLimit-Reset":       "2", // секунды округляются вверх
+		"X-RateLimit-Limit":     "10",
+		"X-RateLimit-Remaining": "3",
+	}
+	for name, value := range want {
+		if got := h.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-RateLimit-Reset is not a Unix time: %v", err)
+	}
+	if now := time.Now().Unix(); reset < now || reset > now+2 {
+		t.Errorf("X-RateLimit-Reset = %d, want about %d", reset, now+1)
+	}
+}
+
+func TestWriteRetryAfter(t *testing.T) {
+	tests := []struct {
+		retry time.Duration
+		want  string
+	}{
+		{0, "1"},
+		{100 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1100 * time.Millisecond, "2"},
+		{time.Minute, "60"},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		State{RetryAfter: tt.retry}.WriteRetryAfter(h)
+		if got := h.Get("Retry-After"); got != tt.want {
+			t.Errorf("Retry-After for %s = %q, want %q", tt.retry, got, tt.want)
+		}
+	}
+}
+
+// заголовки отражают состояние после списания токенов
+func TestStateHeaders(t *testing.T) {
+	rl := newTestRateLimiter(t, `{"default": {"capacity": 5, "rate": 1}}`)
+	rl.TakeTokens("client", 2)
+
+	state, ok := rl.State("client", 1)
+	if !ok {
+		t.Fatal("no state for existing client")
+	}
+	h := http.Header{}
+	state.WriteHeaders(h)
+	if got := h.Get("RateLimit-Limit"); got != "5" {
+		t.Errorf("RateLimit-Limit = %q, want 5", got)
+	}
+	if got := h.Get("RateLimit-Remaining"); got != "3" {
+		t.Errorf("RateLimit-Remaining = %q, want 3", got)
+	}
+	if got := h.Get("RateLimit-Reset"); got != "2" {
+		t.Errorf("RateLimit-Reset = %q, want 2", got)
+	}
+}
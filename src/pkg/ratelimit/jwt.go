@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// JWTVerifier проверяет подпись и срок действия Bearer-токена (HS256, RS256 или ES256):
+// без проверки клиент мог бы подставлять новый sub в каждый запрос и получать новый лимит
+type JWTVerifier struct {
+	secret    []byte           // ключ HS256
+	publicKey crypto.PublicKey // открытый ключ RS256 (*rsa.PublicKey) или ES256 (*ecdsa.PublicKey)
+}
+
+// NewJWTVerifier создает проверку токенов по настройкам, nil - проверка не настроена
+func NewJWTVerifier(cfg *config.JWTConfig) (*JWTVerifier, error) {
+	if cfg == nil || (cfg.Secret == "" && cfg.PublicKeyFile == "") {
+		return nil, nil
+	}
+	if cfg.Secret != "" && cfg.PublicKeyFile != "" {
+		return nil, errors.New("jwt: set either secret or public_key_file")
+	}
+	if cfg.Secret != "" {
+		return &JWTVerifier{secret: []byte(cfg.Secret)}, nil
+	}
+
+	data, err := os.ReadFile(cfg.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt: no PEM data in %s", cfg.PublicKeyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: %w", err)
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().BitSize != 256 {
+			return nil, errors.New("jwt: only P-256 ECDSA keys are supported (ES256)")
+		}
+	default:
+		return nil, fmt.Errorf("jwt: unsupported public key type %T", key)
+	}
+	return &JWTVerifier{publicKey: key}, nil
+}
+
+// Subject возвращает поле sub из Bearer-токена в заголовке Authorization,
+// если подпись верна и срок действия не истёк, иначе ""
+func (v *JWTVerifier) Subject(r *http.Request) string {
+	if v == nil {
+		return ""
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return ""
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if decodeSegment(segments[0], &header) != nil {
+		return ""
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil || !v.verify(header.Algorithm, segments[0]+"."+segments[1], signature) {
+		return ""
+	}
+
+	var claims struct {
+		Subject   string   `json:"sub"`
+		ExpiresAt *float64 `json:"exp"`
+		NotBefore *float64 `json:"nbf"`
+	}
+	if decodeSegment(segments[1], &claims) != nil {
+		return ""
+	}
+	now := float64(time.Now().Unix())
+	if (claims.ExpiresAt != nil && now >= *claims.ExpiresAt) || (claims.NotBefore != nil && now < *claims.NotBefore) {
+		return ""
+	}
+	return claims.Subject
+}
+
+// verify проверяет подпись; алгоритм токена должен соответствовать настроенному ключу
+func (v *JWTVerifier) verify(algorithm, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	switch key := v.publicKey.(type) {
+	case nil:
+		if algorithm != "HS256" {
+			return false
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case *rsa.PublicKey:
+		return algorithm == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		// подпись ES256 - r и s по 32 байта
+		if algorithm != "ES256" || len(signature) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest[:], r, s)
+	}
+	return false
+}
+
+// decodeSegment декодирует JSON из части токена в base64url
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Типы ключей клиента в поле "key" файла rate_limits.json
+const (
+	KeyIP         = "ip"      // адрес клиента (по умолчанию)
+	KeyAPIKey     = "api_key" // заголовок X-API-Key
+	KeyJWTSubject = "jwt_sub" // поле sub из JWT в заголовке Authorization (с проверкой подписи)
+	KeyPath       = "path"    // путь запроса
+	KeyHeader     = "header"  // произвольный заголовок, задаётся как "header:X-Tenant-ID"
+)
+
+// APIKeyHeader - заголовок, из которого берётся API-ключ
+const APIKeyHeader = "X-API-Key"
+
+// разделитель частей составного ключа
+const keySeparator = "|"
+
+// KeyFunc вычисляет ключ клиента, по которому ведётся учёт лимитов
+type KeyFunc func(r *http.Request) string
+
+// keyPart - функция, извлекающая одну часть ключа ("" если значения нет)
+type keyPart func(r *http.Request) string
+
+// ClientIP возвращает адрес клиента из r.RemoteAddr (корректно для IPv6)
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// NewKeyFunc собирает функцию вычисления ключа из списка типов.
+// Адрес клиента записывается в ключ как есть, остальные части - в виде "тип:значение",
+// части составного ключа соединяются через "|" (например "api_key:abc|path:/process").
+// Если какой-то части нет в запросе, вместо неё подставляется адрес клиента,
+// поэтому анонимные клиенты ограничиваются по IP. Часть jwt_sub берётся только из токена
+// с верной подписью (jwt), без настроенной проверки вместо неё всегда используется адрес клиента.
+func NewKeyFunc(types []string, clientIP func(r *http.Request) string, jwt *JWTVerifier) (KeyFunc, error) {
+	if clientIP == nil {
+		clientIP = ClientIP
+	}
+	if len(types) == 0 {
+		types = []string{KeyIP}
+	}
+
+	parts := make([]keyPart, 0, len(types))
+	for _, t := range types {
+		part, err := newKeyPart(t, clientIP, jwt)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+
+	return func(r *http.Request) string {
+		values := make([]string, 0, len(parts))
+		for _, part := range parts {
+			value := part(r)
+			if value == "" {
+				value = clientIP(r)
+			}
+			values = append(values, value)
+		}
+		return strings.Join(values, keySeparator)
+	}, nil
+}
+
+// newKeyPart создает функцию извлечения одной части ключа по её типу
+func newKeyPart(t string, clientIP func(r *http.Request) string, jwt *JWTVerifier) (keyPart, error) {
+	switch {
+	case t == KeyIP:
+		return clientIP, nil
+	case t == KeyAPIKey:
+		return prefixed(KeyAPIKey, func(r *http.Request) string {
+			return r.Header.Get(APIKeyHeader)
+		}), nil
+	case t == KeyJWTSubject:
+		return prefixed(KeyJWTSubject, jwt.Subject), nil
+	case t == KeyPath:
+		return prefixed(KeyPath, func(r *http.Request) string {
+			return r.URL.Path
+		}), nil
+	case strings.HasPrefix(t, KeyHeader+":"):
+		name := http.CanonicalHeaderKey(strings.TrimPrefix(t, KeyHeader+":"))
+		if name == "" {
+			return nil, fmt.Errorf("empty header name in key type %q", t)
+		}
+		return prefixed(t, func(r *http.Request) string {
+			return r.Header.Get(name)
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit key type %q", t)
+	}
+}
+
+// prefixed добавляет к значению части ключа её тип
+func prefixed(prefix string, part keyPart) keyPart {
+	return func(r *http.Request) string {
+		value := part(r)
+		if value == "" {
+			return ""
+		}
+		return prefix + ":" + value
+	}
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// Названия алгоритмов ограничения запросов в rate_limits.json
+const (
+	AlgorithmTokenBucket          = "token_bucket"
+	AlgorithmSlidingWindowLog     = "sliding_window_log"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	AlgorithmGCRA                 = "gcra"
+)
+
+// окно по умолчанию для sliding window алгоритмов
+const defaultWindow = time.Minute
+
+// Limiter - общий интерфейс алгоритмов ограничения запросов одного клиента
+type Limiter interface {
+	TakeTokens(n int) bool // разрешение на выполнение запроса стоимостью n токенов
+	ReturnTokens(n int)    // возврат токенов, если запрос не был выполнен
+	State(n int) State     // текущее состояние лимита для заголовков ответа на запрос стоимостью n
+
+	Snapshot() LimiterSnapshot // снимок внутреннего состояния для сохранения между перезапусками
+	Restore(LimiterSnapshot)   // восстановление состояния из снимка
+}
+
+// LimiterSnapshot - внутреннее состояние ограничителя, каждый алгоритм заполняет свои поля.
+// Все моменты времени абсолютные, поэтому время простоя учитывается при восстановлении.
+type LimiterSnapshot struct {
+	Tokens      float64     `json:"tokens,omitempty"`      // token bucket: токены
+	LastRefill  time.Time   `json:"last_refill,omitzero"`  // token bucket: время последнего пополнения
+	Log         []time.Time `json:"log,omitempty"`         // sliding window log: время запросов
+	WindowStart time.Time   `json:"window_start,omitzero"` // sliding window counter: начало окна
+	Current     int         `json:"current,omitempty"`     // sliding window counter: запросов в текущем окне
+	Previous    int         `json:"previous,omitempty"`    // sliding window counter: запросов в предыдущем окне
+	TAT         time.Time   `json:"tat,omitzero"`          // GCRA: теоретическое время прибытия
+}
+
+// State - состояние лимита клиента
+type State struct {
+	Limit      int           // максимальное количество запросов (емкость / размер окна / всплеск)
+	Remaining  int           // сколько запросов можно выполнить прямо сейчас
+	Reset      time.Duration // время до полного восстановления лимита
+	RetryAfter time.Duration // время до появления места для запроса запрошенной стоимости (0 - доступен сейчас)
+}
+
+// clampCost ограничивает стоимость запроса лимитом: запрос дороже лимита
+// занимает весь лимит, иначе он не был бы выполнен никогда
+func clampCost(n, limit int) int {
+	return min(max(n, 1), limit)
+}
+
+// durationFromSeconds переводит дробное количество секунд в time.Duration
+func durationFromSeconds(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// NewLimiter создает ограничитель по настройкам клиента
+func NewLimiter(cfg config.ClientConfig) (Limiter, error) {
+	if cfg.Capacity <= 0 {
+		return nil, fmt.Errorf("invalid capacity %d", cfg.Capacity)
+	}
+	if cfg.MaxInFlight < 0 {
+		return nil, fmt.Errorf("invalid max_in_flight %d", cfg.MaxInFlight)
+	}
+	// скорость пополнения нужна token bucket и GCRA, окнам она не нужна, но отрицательной быть не может
+	if cfg.Rate < 0 {
+		return nil, fmt.Errorf("invalid rate %v", cfg.Rate)
+	}
+	window := cfg.Window.Duration
+	if window <= 0 {
+		window = defaultWindow
+	}
+
+	switch cfg.Algorithm {
+	case "", AlgorithmTokenBucket:
+		if cfg.Rate <= 0 {
+			return nil, fmt.Errorf("token bucket requires positive rate, got %v", cfg.Rate)
+		}
+		return NewBucket(cfg.Capacity, cfg.Rate), nil
+	case AlgorithmSlidingWindowLog:
+		return NewSlidingWindowLog(cfg.Capacity, window), nil
+	case AlgorithmSlidingWindowCounter:
+		return NewSlidingWindowCounter(cfg.Capacity, window), nil
+	case AlgorithmGCRA:
+		if cfg.Rate <= 0 {
+			return nil, fmt.Errorf("gcra requires positive rate, got %v", cfg.Rate)
+		}
+		return NewGCRA(cfg.Capacity, cfg.Rate), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", cfg.Algorithm)
+	}
+}
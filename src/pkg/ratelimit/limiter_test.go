@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// шаг сценария: списание n токенов и ожидаемый результат
+type take struct {
+	n    int
+	want bool
+}
+
+func TestLimiters(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter Limiter
+		takes   []take
+	}{
+		{"token bucket", NewBucket(3, 1), []take{{1, true}, {2, true}, {1, false}}},
+		{"token bucket cost", NewBucket(5, 1), []take{{4, true}, {2, false}, {1, true}}},
+		{"sliding window log", NewSlidingWindowLog(3, time.Minute), []take{{1, true}, {1, true}, {1, true}, {1, false}}},
+		{"sliding window log cost", NewSlidingWindowLog(5, time.Minute), []take{{3, true}, {3, false}, {2, true}}},
+		{"sliding window counter", NewSlidingWindowCounter(3, time.Minute), []take{{2, true}, {1, true}, {1, false}}},
+		{"gcra", NewGCRA(3, 1), []take{{1, true}, {1, true}, {1, true}, {1, false}}},
+		{"gcra cost", NewGCRA(5, 1), []take{{5, true}, {1, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, step := range tt.takes {
+				if got := tt.limiter.TakeTokens(step.n); got != step.want {
+					t.Fatalf("take %d (n=%d) = %v, want %v", i, step.n, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+// стоимость больше лимита ограничивается лимитом: запрос проходит при полном лимите,
+// а Retry-After после отказа указывает на время восстановления всей стоимости
+func TestLimitersCostAboveLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limiter  Limiter
+		minRetry time.Duration
+	}{
+		{"token bucket", NewBucket(5, 1), 4 * time.Second},
+		{"sliding window log", NewSlidingWindowLog(5, time.Minute), 59 * time.Second},
+		{"sliding window counter", NewSlidingWindowCounter(5, time.Minute), 59 * time.Second},
+		{"gcra", NewGCRA(5, 1), 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if state := tt.limiter.State(9); state.Remaining != 5 || state.RetryAfter != 0 {
+				t.Fatalf("state before = %+v, want 5 remaining and no retry", state)
+			}
+			if !tt.limiter.TakeTokens(9) {
+				t.Fatal("request costing more than the limit is rejected with full limit")
+			}
+			if tt.limiter.TakeTokens(9) {
+				t.Fatal("second request is allowed with empty limit")
+			}
+			if state := tt.limiter.State(9); state.RetryAfter < tt.minRetry {
+				t.Fatalf("RetryAfter = %v, want at least %v", state.RetryAfter, tt.minRetry)
+			}
+			tt.limiter.ReturnTokens(9)
+			if state := tt.limiter.State(1); state.Remaining != 5 {
+				t.Fatalf("remaining after return = %d, want 5", state.Remaining)
+			}
+		})
+	}
+}
+
+// при частично израсходованном лимите Retry-After считается для стоимости запроса, а не для одного токена
+func TestLimitersRetryAfterForCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter Limiter
+	}{
+		{"token bucket", NewBucket(5, 1)},
+		{"sliding window log", NewSlidingWindowLog(5, time.Minute)},
+		{"sliding window counter", NewSlidingWindowCounter(5, time.Minute)},
+		{"gcra", NewGCRA(5, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.limiter.TakeTokens(3)
+			if state := tt.limiter.State(1); state.RetryAfter != 0 {
+				t.Fatalf("RetryAfter for cost 1 = %v, want 0", state.RetryAfter)
+			}
+			if tt.limiter.TakeTokens(4) {
+				t.Fatal("request costing 4 is allowed with 2 remaining")
+			}
+			if state := tt.limiter.State(4); state.RetryAfter <= 0 {
+				t.Fatalf("RetryAfter for cost 4 = %v, want positive", state.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestGCRARetryAfter(t *testing.T) {
+	g := NewGCRA(2, 10) // интервал 100ms
+	g.TakeTokens(2)
+	state := g.State(1)
+	if state.Remaining != 0 {
+		t.Fatalf("remaining = %d, want 0", state.Remaining)
+	}
+	if state.RetryAfter <= 0 || state.RetryAfter > 100*time.Millisecond {
+		t.Fatalf("RetryAfter = %v, want (0, 100ms]", state.RetryAfter)
+	}
+	time.Sleep(state.RetryAfter + 10*time.Millisecond)
+	if !g.TakeTokens(1) {
+		t.Fatal("request after RetryAfter is rejected")
+	}
+}
+
+func TestSlidingWindowLogExpires(t *testing.T) {
+	l := NewSlidingWindowLog(2, 50*time.Millisecond)
+	l.TakeTokens(2)
+	if l.TakeTokens(1) {
+		t.Fatal("request over the limit is allowed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !l.TakeTokens(1) {
+		t.Fatal("request after the window is rejected")
+	}
+}
+
+func TestSlidingWindowCounterEstimate(t *testing.T) {
+	c := NewSlidingWindowCounter(10, time.Minute)
+	now := c.windowStart.Add(15 * time.Second) // четверть текущего окна
+	c.previous, c.current = 8, 2
+	// 8 * 0.75 + 2 = 8
+	if got := c.estimate(now); got != 8 {
+		t.Fatalf("estimate = %v, want 8", got)
+	}
+}
+
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ClientConfig
+		want    string
+		wantErr bool
+	}{
+		{"default algorithm", config.ClientConfig{Capacity: 5, Rate: 1}, "*ratelimit.Bucket", false},
+		{"sliding window log", config.ClientConfig{Algorithm: AlgorithmSlidingWindowLog, Capacity: 5}, "*ratelimit.SlidingWindowLog", false},
+		{"sliding window counter", config.ClientConfig{Algorithm: AlgorithmSlidingWindowCounter, Capacity: 5}, "*ratelimit.SlidingWindowCounter", false},
+		{"gcra", config.ClientConfig{Algorithm: AlgorithmGCRA, Capacity: 5, Rate: 2}, "*ratelimit.GCRA", false},
+		{"gcra without rate", config.ClientConfig{Algorithm: AlgorithmGCRA, Capacity: 5}, "", true},
+		{"gcra above 1e9 rate", config.ClientConfig{Algorithm: AlgorithmGCRA, Capacity: 5, Rate: 1e10}, "*ratelimit.GCRA", false},
+		{"token bucket without rate", config.ClientConfig{Capacity: 5}, "", true},
+		{"negative rate", config.ClientConfig{Capacity: 5, Rate: -1}, "", true},
+		{"negative rate for window", config.ClientConfig{Algorithm: AlgorithmSlidingWindowLog, Capacity: 5, Rate: -1}, "", true},
+		{"zero capacity", config.ClientConfig{Rate: 1}, "", true},
+		{"unknown algorithm", config.ClientConfig{Algorithm: "leaky", Capacity: 5}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewLimiter(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if got := fmt.Sprintf("%T", limiter); got != tt.want {
+					t.Fatalf("limiter = %s, want %s", got, tt.want)
+				}
+				// ограничитель работает без паники при любых допустимых настройках
+				limiter.TakeTokens(1)
+				limiter.State(1)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// RadixTree - двоичное префиксное дерево для поиска самого длинного
+// совпадающего префикса (CIDR). Время поиска не зависит от количества правил
+// и ограничено длиной адреса (32 бита для IPv4, 128 для IPv6).
+type RadixTree[V any] struct {
+	mu sync.RWMutex  // мьютекс защиты дерева
+	v4 *radixNode[V] // корень для IPv4
+	v6 *radixNode[V] // корень для IPv6
+	n  int           // количество префиксов в дереве
+}
+
+// узел дерева, значение есть только у узлов, соответствующих добавленным префиксам
+type radixNode[V any] struct {
+	children [2]*radixNode[V]
+	value    V
+	set      bool
+}
+
+// NewRadixTree создает пустое дерево
+func NewRadixTree[V any]() *RadixTree[V] {
+	return &RadixTree[V]{
+		v4: &radixNode[V]{},
+		v6: &radixNode[V]{},
+	}
+}
+
+// root возвращает корень для семейства адреса
+func (t *RadixTree[V]) root(addr netip.Addr) *radixNode[V] {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// bit возвращает i-й бит адреса (старший бит первый)
+func bit(bytes []byte, i int) int {
+	return int(bytes[i/8]>>(7-uint(i%8))) & 1
+}
+
+// Insert добавляет префикс, значение для уже существующего префикса заменяется
+func (t *RadixTree[V]) Insert(prefix netip.Prefix, value V) {
+	prefix = unmapPrefix(prefix).Masked()
+	bytes := prefix.Addr().AsSlice()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.root(prefix.Addr())
+	for i := 0; i < prefix.Bits(); i++ {
+		b := bit(bytes, i)
+		if node.children[b] == nil {
+			node.children[b] = &radixNode[V]{}
+		}
+		node = node.children[b]
+	}
+	if !node.set {
+		t.n++
+	}
+	node.value = value
+	node.set = true
+}
+
+// Lookup ищет самый длинный префикс, содержащий адрес
+func (t *RadixTree[V]) Lookup(addr netip.Addr) (value V, bits int, ok bool) {
+	addr = addr.Unmap()
+	bytes := addr.AsSlice()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.root(addr)
+	bits = -1
+	for i := 0; ; i++ {
+		if node.set {
+			value, bits, ok = node.value, i, true
+		}
+		if i == addr.BitLen() {
+			break
+		}
+		node = node.children[bit(bytes, i)]
+		if node == nil {
+			break
+		}
+	}
+	return value, bits, ok
+}
+
+// Len возвращает количество префиксов в дереве
+func (t *RadixTree[V]) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.n
+}
+
+// unmapPrefix приводит IPv4-mapped IPv6 префикс (::ffff:a.b.c.d/n) к IPv4
+func unmapPrefix(prefix netip.Prefix) netip.Prefix {
+	addr := prefix.Addr()
+	if !addr.Is4In6() {
+		return prefix
+	}
+	bits := prefix.Bits() - 96
+	if bits < 0 {
+		bits = 0
+	}
+	return netip.PrefixFrom(addr.Unmap(), bits)
+}
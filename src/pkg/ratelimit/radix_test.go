@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+func TestRadixTreeLookup(t *testing.T) {
+	tree := NewRadixTree[string]()
+	for prefix, value := range map[string]string{
+		"10.0.0.0/8":            "office",
+		"10.1.0.0/16":           "lab",
+		"10.1.2.3/32":           "host",
+		"192.168.0.0/16":        "home",
+		"2001:db8::/32":         "v6",
+		"2001:db8:1::/48":       "v6-lab",
+		"::ffff:172.16.0.0/108": "mapped",
+	} {
+		tree.Insert(netip.MustParsePrefix(prefix), value)
+	}
+
+	tests := []struct {
+		addr     string
+		want     string
+		wantBits int
+		wantOK   bool
+	}{
+		{"10.2.3.4", "office", 8, true},
+		{"10.1.9.9", "lab", 16, true},
+		{"10.1.2.3", "host", 32, true},
+		{"192.168.255.1", "home", 16, true},
+		{"11.0.0.1", "", -1, false},
+		{"::ffff:10.1.2.3", "host", 32, true}, // IPv4-mapped адрес ищется среди IPv4
+		{"172.16.5.5", "mapped", 12, true},    // IPv4-mapped префикс хранится как IPv4
+		{"2001:db8:2::1", "v6", 32, true},
+		{"2001:db8:1::1", "v6-lab", 48, true},
+		{"2001:db9::1", "", -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, bits, ok := tree.Lookup(netip.MustParseAddr(tt.addr))
+			if got != tt.want || bits != tt.wantBits || ok != tt.wantOK {
+				t.Fatalf("Lookup = (%q, %d, %v), want (%q, %d, %v)", got, bits, ok, tt.want, tt.wantBits, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRadixTreeInsertReplaces(t *testing.T) {
+	tree := NewRadixTree[int]()
+	tree.Insert(netip.MustParsePrefix("10.0.0.0/8"), 1)
+	tree.Insert(netip.MustParsePrefix("10.9.9.9/8"), 2) // тот же префикс после маскирования
+	tree.Insert(netip.MustParsePrefix("0.0.0.0/0"), 3)
+
+	if tree.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", tree.Len())
+	}
+	if got, _, _ := tree.Lookup(netip.MustParseAddr("10.0.0.1")); got != 2 {
+		t.Fatalf("Lookup = %d, want 2", got)
+	}
+	if got, bits, _ := tree.Lookup(netip.MustParseAddr("8.8.8.8")); got != 3 || bits != 0 {
+		t.Fatalf("Lookup = (%d, %d), want default route (3, 0)", got, bits)
+	}
+	if _, _, ok := tree.Lookup(netip.MustParseAddr("::1")); ok {
+		t.Fatal("IPv6 address matches IPv4 default route")
+	}
+}
+
+func TestRulesLimitsAndAccess(t *testing.T) {
+	rules := NewRules(&config.RateLimitConfig{
+		Groups: map[string]config.GroupConfig{
+			"office": {ClientConfig: config.ClientConfig{Capacity: 100, Rate: 1}, CIDRs: []string{"10.0.0.0/8"}},
+		},
+		Clients: map[string]config.ClientConfig{
+			"10.0.0.5":    {Capacity: 5, Rate: 1},
+			"10.1.0.0/16": {Capacity: 50, Rate: 1},
+			"api_key:abc": {Capacity: 7, Rate: 1},
+		},
+		Deny: []string{"10.1.2.0/24"},
+	})
+
+	tests := []struct {
+		key      string
+		capacity int
+		ok       bool
+		allowed  bool
+	}{
+		{"10.0.0.5", 5, true, true},
+		{"10.1.9.9", 50, true, true},
+		{"10.9.9.9", 100, true, true},
+		{"10.1.2.3", 50, true, false},
+		{"api_key:abc", 7, true, true},
+		{"api_key:xyz|10.0.0.5", 5, true, true}, // адрес из составного ключа
+		{"8.8.8.8", 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			cfg, ok := rules.Limits(tt.key)
+			if ok != tt.ok || cfg.Capacity != tt.capacity {
+				t.Fatalf("Limits = (%d, %v), want (%d, %v)", cfg.Capacity, ok, tt.capacity, tt.ok)
+			}
+			if _, err := netip.ParseAddr(tt.key); err != nil {
+				return // списки доступа проверяются только по адресу
+			}
+			if got := rules.Allowed(tt.key); got != tt.allowed {
+				t.Fatalf("Allowed = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
@@ -1,62 +1,137 @@
 package ratelimit
 
 import (
+	"fmt"
 	"log"
+	"net/http"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/pozedorum/load_balancer/config"
 )
 
-const RateLimitsConfigPath = "config/rate_limits.json"
+const RateLimitsConfigPath = config.DefaultRateLimitsPath
 
 // RateLimiter представляет собой модуль rate-limiting
 type RateLimiter struct {
-	mu              sync.RWMutex       // мьютекс защиты данных
-	clients         map[string]*Client // список клиентов (в клиентах лежат их бакеты)
-	cleanupInterval time.Duration      // Интервал очистки
-	inactiveTimeout time.Duration      // Таймаут неактивности
-	stopChan        chan struct{}      // Канал для остановки очистки
-	defaultCapacity int
-	defaultRate     int
+	mu              sync.RWMutex                   // мьютекс защиты данных
+	clients         map[string]*Client             // список клиентов (в клиентах лежат их бакеты)
+	cleanupInterval time.Duration                  // Интервал очистки
+	inactiveTimeout time.Duration                  // Таймаут неактивности
+	stopChan        chan struct{}                  // Канал для остановки очистки
+	defaultConfig   config.ClientConfig            // настройки ограничителя по умолчанию
+	keyTypes        []string                       // из чего составляется ключ клиента
+	keyFunc         KeyFunc                        // функция вычисления ключа клиента по запросу
+	jwt             *JWTVerifier                   // проверка подписи JWT для ключа jwt_sub (nil - не настроена)
+	rules           *Rules                         // лимиты по ключам, CIDR и группам, allow/deny списки
+	classes         *config.RateLimitConfig        // классы лимитов для переопределений через admin API
+	overrides       map[string]config.ClientConfig // лимиты, заданные через admin API
+	costFunc        CostFunc                       // стоимость запроса в токенах
 }
 
 // NewRateLimiter создает новый модуль rate-limiting
 func NewRateLimiter(cleanupInterval, inactiveTimeout time.Duration) *RateLimiter {
+	keyFunc, _ := NewKeyFunc(nil, nil, nil) // ключ по IP клиента
 	rl := &RateLimiter{
 		clients:         make(map[string]*Client),
 		cleanupInterval: cleanupInterval,
 		inactiveTimeout: inactiveTimeout,
 		stopChan:        make(chan struct{}),
-		defaultCapacity: 10, // значения по умолчанию
-		defaultRate:     1,
+		defaultConfig:   config.ClientConfig{Capacity: 10, Rate: 1}, // значения по умолчанию
+		keyFunc:         keyFunc,
+		rules:           NewRules(&config.RateLimitConfig{}),
+		classes:         &config.RateLimitConfig{},
+		overrides:       make(map[string]config.ClientConfig),
+		costFunc:        NewCostFunc(nil), // каждый запрос стоит 1 токен
 	}
 	go rl.startCleanup()
 	return rl
 }
 
+// NewRateLimiterWithConfig создает модуль rate-limiting с лимитами из config/rate_limits.json
 func NewRateLimiterWithConfig(cleanupInterval, inactiveTimeout time.Duration) *RateLimiter {
+	return NewRateLimiterFromFile(RateLimitsConfigPath, cleanupInterval, inactiveTimeout)
+}
+
+// NewRateLimiterFromFile создает модуль rate-limiting с лимитами из файла,
+// если файл не загрузился - используются значения по умолчанию
+func NewRateLimiterFromFile(path string, cleanupInterval, inactiveTimeout time.Duration) *RateLimiter {
 	rl := NewRateLimiter(cleanupInterval, inactiveTimeout)
 
 	// Загружаем и применяем конфиг
-	if cfg, err := config.LoadRateLimitConfig(RateLimitsConfigPath); err == nil {
-		rl.defaultCapacity = cfg.Default.Capacity
-		rl.defaultRate = cfg.Default.Rate
-
-		// Предварительно создаем клиентов из конфига
-		for ip, clientCfg := range cfg.Clients {
-			rl.clients[ip] = NewClient(ip, clientCfg.Capacity, clientCfg.Rate)
+	if cfg, err := config.LoadRateLimitConfig(path); err == nil {
+		jwt, err := NewJWTVerifier(cfg.JWT)
+		if err != nil {
+			log.Printf("Invalid JWT settings: %v. jwt_sub falls back to client IP", err)
+		} else if jwt == nil && slices.Contains(cfg.Key, KeyJWTSubject) {
+			log.Printf("JWT verification is not configured: jwt_sub falls back to client IP")
+		}
+		if keyFunc, err := NewKeyFunc(cfg.Key, nil, jwt); err == nil {
+			rl.keyTypes = cfg.Key
+			rl.keyFunc = keyFunc
+			rl.jwt = jwt
+		} else {
+			log.Printf("Invalid rate limit key: %v. Using client IP", err)
+		}
+		if defaultCfg, err := cfg.Resolve(cfg.Default); err == nil {
+			if _, err = NewLimiter(defaultCfg); err == nil {
+				rl.defaultConfig = defaultCfg
+			} else {
+				log.Printf("Invalid default rate limit: %v. Using defaults", err)
+			}
+		} else {
+			log.Printf("Invalid default rate limit: %v. Using defaults", err)
 		}
+
+		// Клиенты из конфига создаются при первом запросе по этим правилам
+		rl.rules = NewRules(cfg)
+		rl.classes = cfg
+		rl.costFunc = NewCostFunc(cfg.Costs)
 	} else {
 		// Логируем ошибку, если конфиг не загрузился
-		log.Printf("Failed to load rate limit config: %v. Using defaults", err)
+		log.Printf("Failed to load rate limit config %s: %v. Using defaults", path, err)
 	}
 
 	return rl
 }
 
+// Key возвращает ключ клиента, по которому учитываются лимиты запроса
+func (rl *RateLimiter) Key(r *http.Request) string {
+	return rl.keyFunc(r)
+}
+
+// Cost возвращает стоимость запроса в токенах
+func (rl *RateLimiter) Cost(r *http.Request) int {
+	return rl.costFunc(r)
+}
+
+// SetClientIPFunc задаёт функцию определения адреса клиента для ключа
+// (например, с учётом доверенных прокси)
+func (rl *RateLimiter) SetClientIPFunc(clientIP func(r *http.Request) string) {
+	// типы ключа уже проверены при создании, ошибки здесь быть не может
+	rl.keyFunc, _ = NewKeyFunc(rl.keyTypes, clientIP, rl.jwt)
+}
+
+// limitsFor возвращает настройки лимита для нового клиента, вызывается под мьютексом
+func (rl *RateLimiter) limitsFor(key string) config.ClientConfig {
+	if cfg, ok := rl.overrides[key]; ok {
+		return cfg
+	}
+	if cfg, ok := rl.rules.Limits(key); ok {
+		return cfg
+	}
+	return rl.defaultConfig
+}
+
+// Allowed проверяет адрес клиента по allow/deny спискам
+func (rl *RateLimiter) Allowed(ip string) bool {
+	return rl.rules.Allowed(ip)
+}
+
 // AddClient добавляет нового клиента в модуль rate-limiting
-func (r *RateLimiter) AddClient(ip string, capacity, rate int) {
+func (r *RateLimiter) AddClient(ip string, capacity int, rate float64) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.clients[ip] = NewClient(ip, capacity, rate)
@@ -64,29 +139,163 @@ func (r *RateLimiter) AddClient(ip string, capacity, rate int) {
 
 // TakeToken извлекает токен из bucket клиента, если он доступен
 func (rl *RateLimiter) TakeToken(ip string) bool {
+	return rl.TakeTokens(ip, 1)
+}
+
+// TakeTokens извлекает n токенов (стоимость запроса) из ограничителя клиента, если они доступны
+func (rl *RateLimiter) TakeTokens(ip string, n int) bool {
+	client := rl.getOrCreateClient(ip)
+	client.UpdateLastSeen()
+	return client.TakeTokens(n)
+}
+
+// getOrCreateClient возвращает клиента, если его нет - создает по подходящему правилу
+// или с дефолтными настройками (все настройки проверены при загрузке конфига)
+func (rl *RateLimiter) getOrCreateClient(ip string) *Client {
 	rl.mu.Lock()
+	// в клиенте свой мьютекс, так что здесь его надо разблокировать
+	defer rl.mu.Unlock()
 
 	client, exists := rl.clients[ip]
 	if !exists {
-		// Если клиента нет, создаем с дефолтными настройками
-		client = NewClient(ip, rl.defaultCapacity, rl.defaultRate)
+		client, _ = newClientWithConfig(ip, rl.limitsFor(ip))
 		rl.clients[ip] = client
 	}
-	// в клиенте свой мьютекс, так что здесь его надо разблокировать
-	rl.mu.Unlock()
+	return client
+}
 
-	client.UpdateLastSeen()
-	return client.TakeToken()
+// Acquire занимает слот выполняющегося запроса клиента (ограничение max_in_flight).
+// При успехе возвращает функцию освобождения слота, которую нужно вызвать ровно один раз
+// после завершения запроса.
+func (rl *RateLimiter) Acquire(ip string) (release func(), ok bool) {
+	client := rl.getOrCreateClient(ip)
+	if !client.Acquire() {
+		return nil, false
+	}
+	var once sync.Once
+	return func() { once.Do(client.Release) }, true
 }
 
 // Возват токена в случае невыполнения запроса (возникла ошибка при выполнении)
 func (r *RateLimiter) ReturnToken(ip string) {
+	r.ReturnTokens(ip, 1)
+}
+
+// Возврат n токенов (стоимости запроса) в случае невыполнения запроса
+func (r *RateLimiter) ReturnTokens(ip string, n int) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	if client, exists := r.clients[ip]; exists {
-		client.ReturnToken()
+		client.ReturnTokens(n)
+	}
+}
+
+// State возвращает состояние лимита клиента для запроса стоимостью n, ok=false если клиент неизвестен
+func (r *RateLimiter) State(ip string, n int) (State, bool) {
+	r.mu.RLock()
+	client, exists := r.clients[ip]
+	r.mu.RUnlock()
+
+	if !exists {
+		return State{}, false
+	}
+	return client.State(n), true
+}
+
+// Clients возвращает сведения обо всех известных клиентах, отсортированные по ключу
+func (rl *RateLimiter) Clients() []ClientInfo {
+	rl.mu.RLock()
+	clients := make([]*Client, 0, len(rl.clients))
+	for _, client := range rl.clients {
+		clients = append(clients, client)
+	}
+	rl.mu.RUnlock()
+
+	infos := make([]ClientInfo, 0, len(clients))
+	for _, client := range clients {
+		infos = append(infos, client.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
+
+// ClientInfo возвращает сведения о клиенте, ok=false если клиент неизвестен
+func (rl *RateLimiter) ClientInfo(key string) (ClientInfo, bool) {
+	rl.mu.RLock()
+	client, exists := rl.clients[key]
+	rl.mu.RUnlock()
+	if !exists {
+		return ClientInfo{}, false
+	}
+	return client.Info(), true
+}
+
+// SetLimits переопределяет лимиты клиента во время работы, класс лимитов подставляется
+// так же, как при загрузке конфига. Ограничитель существующего клиента пересоздаётся
+// (с полным запасом запросов)
+func (rl *RateLimiter) SetLimits(key string, cfg config.ClientConfig) error {
+	cfg, err := rl.classes.Resolve(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid limits: %w", err)
+	}
+	limiter, err := NewLimiter(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid limits: %w", err)
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.overrides[key] = cfg
+	if client, exists := rl.clients[key]; exists {
+		client.SetLimiter(limiter, cfg)
+	}
+	return nil
+}
+
+// ClearLimits убирает переопределение лимитов, клиент возвращается к лимитам из конфига
+func (rl *RateLimiter) ClearLimits(key string) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	delete(rl.overrides, key)
+	if client, exists := rl.clients[key]; exists {
+		cfg := rl.limitsFor(key)
+		limiter, _ := NewLimiter(cfg)
+		client.SetLimiter(limiter, cfg)
+	}
+}
+
+// ResetClient восстанавливает полный запас запросов клиента, ok=false если клиент неизвестен
+func (rl *RateLimiter) ResetClient(key string) bool {
+	rl.mu.RLock()
+	client, exists := rl.clients[key]
+	rl.mu.RUnlock()
+	if !exists {
+		return false
+	}
+	cfg := client.Limits()
+	limiter, _ := NewLimiter(cfg)
+	client.SetLimiter(limiter, cfg)
+	return true
+}
+
+// Ban блокирует клиента на указанное время (клиент создается, если его ещё нет)
+func (rl *RateLimiter) Ban(key string, duration time.Duration) time.Time {
+	until := time.Now().Add(duration)
+	rl.getOrCreateClient(key).Ban(until)
+	return until
+}
+
+// Unban снимает блокировку клиента, ok=false если клиент неизвестен
+func (rl *RateLimiter) Unban(key string) bool {
+	rl.mu.RLock()
+	client, exists := rl.clients[key]
+	rl.mu.RUnlock()
+	if !exists {
+		return false
 	}
+	client.Unban()
+	return true
 }
 
 // Разрешение на взятие токена из бакета (разрешение на выполнение запроса)
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// newTestRateLimiter создает RateLimiter с настройками из JSON
+func newTestRateLimiter(t *testing.T, cfg string) *RateLimiter {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rate_limits.json")
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rl := NewRateLimiterFromFile(path, time.Minute, time.Minute)
+	t.Cleanup(rl.Stop)
+	return rl
+}
+
+const testClassesConfig = `{
+	"default": {"capacity": 10, "rate": 1},
+	"classes": {
+		"api-quota": {"algorithm": "sliding_window_counter", "capacity": 60, "window": "1m", "max_in_flight": 2}
+	}
+}`
+
+func TestSetLimitsClass(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  config.ClientConfig
+		want    config.ClientConfig
+		wantErr bool
+	}{
+		{
+			name:   "class",
+			limits: config.ClientConfig{Class: "api-quota"},
+			want: config.ClientConfig{Class: "api-quota", Algorithm: AlgorithmSlidingWindowCounter,
+				Capacity: 60, Window: config.Duration{Duration: time.Minute}, MaxInFlight: 2},
+		},
+		{
+			name:   "class with override",
+			limits: config.ClientConfig{Class: "api-quota", Capacity: 5},
+			want: config.ClientConfig{Class: "api-quota", Algorithm: AlgorithmSlidingWindowCounter,
+				Capacity: 5, Window: config.Duration{Duration: time.Minute}, MaxInFlight: 2},
+		},
+		{
+			name:   "explicit limits",
+			limits: config.ClientConfig{Capacity: 3, Rate: 1},
+			want:   config.ClientConfig{Capacity: 3, Rate: 1},
+		},
+		{name: "unknown class", limits: config.ClientConfig{Class: "missing"}, wantErr: true},
+		{name: "invalid limits", limits: config.ClientConfig{Capacity: 0, Rate: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := newTestRateLimiter(t, testClassesConfig)
+			rl.TakeToken("client") // клиент уже существует: ограничитель пересоздаётся
+			err := rl.SetLimits("client", tt.limits)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			info, _ := rl.ClientInfo("client")
+			if tt.wantErr {
+				if info.Limits != (config.ClientConfig{Capacity: 10, Rate: 1}) {
+					t.Fatalf("limits changed after error: %+v", info.Limits)
+				}
+				return
+			}
+			if info.Limits != tt.want {
+				t.Fatalf("limits = %+v, want %+v", info.Limits, tt.want)
+			}
+		})
+	}
+}
+
+// переопределение действует и для клиентов, созданных после него, и снимается ClearLimits
+func TestSetLimitsNewClient(t *testing.T) {
+	rl := newTestRateLimiter(t, testClassesConfig)
+	if err := rl.SetLimits("client", config.ClientConfig{Capacity: 1, Rate: 0.001}); err != nil {
+		t.Fatal(err)
+	}
+	if !rl.TakeToken("client") || rl.TakeToken("client") {
+		t.Fatal("override is not applied to a new client")
+	}
+	rl.ClearLimits("client")
+	if info, _ := rl.ClientInfo("client"); info.Limits != (config.ClientConfig{Capacity: 10, Rate: 1}) {
+		t.Fatalf("limits after ClearLimits = %+v", info.Limits)
+	}
+}
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// префикс ссылки на группу в списках allow/deny
+const groupPrefix = "group:"
+
+// Rules - правила выбора лимитов и доступа для клиента.
+// Порядок выбора лимитов: точное совпадение ключа из clients, затем самый
+// длинный CIDR из clients и groups (при равной длине приоритет у clients),
+// затем настройки по умолчанию.
+type Rules struct {
+	exact     map[string]config.ClientConfig  // лимиты по точному ключу клиента
+	cidrs     *RadixTree[config.ClientConfig] // лимиты по CIDR (в том числе из групп)
+	access    *RadixTree[bool]                // allow (true) и deny (false) списки
+	allowList bool                            // задан allow-список: остальные адреса запрещены
+}
+
+// NewRules строит правила по конфигу, некорректные правила пропускаются с записью в лог
+func NewRules(cfg *config.RateLimitConfig) *Rules {
+	rules := &Rules{
+		exact:  make(map[string]config.ClientConfig),
+		cidrs:  NewRadixTree[config.ClientConfig](),
+		access: NewRadixTree[bool](),
+	}
+
+	// сначала группы, чтобы CIDR из clients с той же длиной префикса их переопределяли
+	for name, group := range cfg.Groups {
+		resolved, err := resolveLimits(cfg, group.ClientConfig)
+		if err != nil {
+			log.Printf("Skipping rate limit group %s: %v", name, err)
+			continue
+		}
+		for _, cidr := range group.CIDRs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				log.Printf("Skipping CIDR %s in rate limit group %s: %v", cidr, name, err)
+				continue
+			}
+			rules.cidrs.Insert(prefix, resolved)
+		}
+	}
+
+	for key, clientCfg := range cfg.Clients {
+		resolved, err := resolveLimits(cfg, clientCfg)
+		if err != nil {
+			log.Printf("Skipping rate limit for client %s: %v", key, err)
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(key); err == nil {
+			rules.cidrs.Insert(prefix, resolved)
+			continue
+		}
+		rules.exact[key] = resolved
+	}
+
+	// deny после allow: при совпадении префиксов запрет важнее
+	for _, entry := range cfg.Allow {
+		rules.addAccess(cfg, entry, true)
+	}
+	for _, entry := range cfg.Deny {
+		rules.addAccess(cfg, entry, false)
+	}
+	rules.allowList = len(cfg.Allow) > 0
+
+	return rules
+}
+
+// resolveLimits подставляет настройки класса и проверяет, что по ним создаётся ограничитель
+func resolveLimits(cfg *config.RateLimitConfig, clientCfg config.ClientConfig) (config.ClientConfig, error) {
+	resolved, err := cfg.Resolve(clientCfg)
+	if err != nil {
+		return resolved, err
+	}
+	if _, err := NewLimiter(resolved); err != nil {
+		return resolved, err
+	}
+	return resolved, nil
+}
+
+// addAccess добавляет в allow/deny список адрес, CIDR или группу ("group:office")
+func (r *Rules) addAccess(cfg *config.RateLimitConfig, entry string, allow bool) {
+	prefixes, err := accessPrefixes(cfg, entry)
+	if err != nil {
+		log.Printf("Skipping access rule %s: %v", entry, err)
+		return
+	}
+	for _, prefix := range prefixes {
+		r.access.Insert(prefix, allow)
+	}
+}
+
+// accessPrefixes разворачивает элемент allow/deny списка в набор префиксов
+func accessPrefixes(cfg *config.RateLimitConfig, entry string) ([]netip.Prefix, error) {
+	if name, ok := strings.CutPrefix(entry, groupPrefix); ok {
+		group, exists := cfg.Groups[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown group %q", name)
+		}
+		prefixes := make([]netip.Prefix, 0, len(group.CIDRs))
+		for _, cidr := range group.CIDRs {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		return prefixes, nil
+	}
+	if prefix, err := netip.ParsePrefix(entry); err == nil {
+		return []netip.Prefix{prefix}, nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return nil, err
+	}
+	addr = addr.Unmap()
+	return []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())}, nil
+}
+
+// Limits возвращает настройки лимита для ключа клиента, ok=false если правило не найдено
+func (r *Rules) Limits(key string) (config.ClientConfig, bool) {
+	if cfg, ok := r.exact[key]; ok {
+		return cfg, true
+	}
+	addr, ok := keyAddr(key)
+	if !ok {
+		return config.ClientConfig{}, false
+	}
+	if cfg, ok := r.exact[addr.String()]; ok {
+		return cfg, true
+	}
+	cfg, _, ok := r.cidrs.Lookup(addr)
+	return cfg, ok
+}
+
+// Allowed проверяет адрес клиента по allow/deny спискам (самый длинный префикс решает)
+func (r *Rules) Allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return !r.allowList
+	}
+	allow, _, ok := r.access.Lookup(addr)
+	if !ok {
+		return !r.allowList
+	}
+	return allow
+}
+
+// keyAddr достаёт адрес клиента из ключа (в составном ключе адрес записан без префикса типа)
+func keyAddr(key string) (netip.Addr, bool) {
+	for _, part := range strings.Split(key, keySeparator) {
+		if addr, err := netip.ParseAddr(part); err == nil {
+			return addr.Unmap(), true
+		}
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// Snapshot - сохранённое состояние ограничителя запросов
+type Snapshot struct {
+	SavedAt   time.Time                      `json:"saved_at"`
+	Clients   []ClientSnapshot               `json:"clients"`
+	Overrides map[string]config.ClientConfig `json:"overrides,omitempty"`
+}
+
+// ClientSnapshot - сохранённое состояние клиента
+type ClientSnapshot struct {
+	Key         string              `json:"key"`
+	Limits      config.ClientConfig `json:"limits"`
+	LastSeen    time.Time           `json:"last_seen"`
+	BannedUntil time.Time           `json:"banned_until,omitzero"`
+	State       LimiterSnapshot     `json:"state"`
+}
+
+// snapshot собирает состояние клиента
+func (c *Client) snapshot() ClientSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return ClientSnapshot{
+		Key:         c.ip,
+		Limits:      c.limits,
+		LastSeen:    c.lastSeen,
+		BannedUntil: c.bannedUntil,
+		State:       c.limiter.Snapshot(),
+	}
+}
+
+// Snapshot собирает состояние всех клиентов и переопределённых лимитов
+func (rl *RateLimiter) Snapshot() Snapshot {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	s := Snapshot{
+		SavedAt:   time.Now(),
+		Clients:   make([]ClientSnapshot, 0, len(rl.clients)),
+		Overrides: make(map[string]config.ClientConfig, len(rl.overrides)),
+	}
+	for _, client := range rl.clients {
+		s.Clients = append(s.Clients, client.snapshot())
+	}
+	for key, cfg := range rl.overrides {
+		s.Overrides[key] = cfg
+	}
+	return s
+}
+
+// Restore восстанавливает клиентов из снимка. Клиенты, неактивные дольше таймаута,
+// и клиенты, лимиты которых изменились в конфиге, не восстанавливаются.
+func (rl *RateLimiter) Restore(s Snapshot) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key, cfg := range s.Overrides {
+		if _, err := NewLimiter(cfg); err != nil {
+			log.Printf("Skipping saved limits override for %s: %v", key, err)
+			continue
+		}
+		rl.overrides[key] = cfg
+	}
+
+	now := time.Now()
+	restored := 0
+	for _, saved := range s.Clients {
+		banned := now.Before(saved.BannedUntil)
+		if now.Sub(saved.LastSeen) >= rl.inactiveTimeout && !banned {
+			continue
+		}
+		if saved.Limits != rl.limitsFor(saved.Key) {
+			continue
+		}
+		client, err := newClientWithConfig(saved.Key, saved.Limits)
+		if err != nil {
+			continue
+		}
+		client.limiter.Restore(saved.State)
+		client.lastSeen = saved.LastSeen
+		client.bannedUntil = saved.BannedUntil
+		rl.clients[saved.Key] = client
+		restored++
+	}
+	log.Printf("Restored %d rate limit clients from snapshot saved at %s",
+		restored, s.SavedAt.Format(time.RFC3339))
+}
+
+// SaveSnapshot атомарно записывает снимок в файл (через временный файл и переименование)
+func (rl *RateLimiter) SaveSnapshot(path string) error {
+	data, err := json.Marshal(rl.Snapshot())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadSnapshot восстанавливает состояние из файла, отсутствие файла ошибкой не считается
+func (rl *RateLimiter) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	rl.Restore(s)
+	return nil
+}
+
+// StartSnapshots периодически сохраняет состояние в файл до вызова Stop
+func (rl *RateLimiter) StartSnapshots(path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := rl.SaveSnapshot(path); err != nil {
+					log.Printf("Failed to save rate limit snapshot: %v", err)
+				}
+			case <-rl.stopChan:
+				return
+			}
+		}
+	}()
+}
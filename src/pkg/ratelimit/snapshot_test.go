@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pozedorum/load_balancer/config"
+)
+
+// лимиты почти без пополнения, чтобы остаток не менялся за время теста
+const testSnapshotConfig = `{"default": {"capacity": 10, "rate": 0.001}}`
+
+// remainingOf возвращает остаток токенов клиента (-1 если клиента нет)
+func remainingOf(rl *RateLimiter, key string) int {
+	info, ok := rl.ClientInfo(key)
+	if !ok {
+		return -1
+	}
+	return info.Remaining
+}
+
+func TestSnapshotFile(t *testing.T) {
+	rl := newTestRateLimiter(t, testSnapshotConfig)
+	rl.TakeTokens("client", 4)
+	rl.Ban("banned", time.Hour)
+	if err := rl.SetLimits("custom", config.ClientConfig{Capacity: 3, Rate: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "state", "snapshot.json")
+	if err := rl.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestRateLimiter(t, testSnapshotConfig)
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := remainingOf(restored, "client"); got != 6 {
+		t.Fatalf("restored remaining = %d, want 6", got)
+	}
+	if info, _ := restored.ClientInfo("banned"); info.BannedUntil == nil {
+		t.Fatal("ban is not restored")
+	}
+	// переопределение действует и для клиента, которого не было в снимке
+	restored.TakeToken("custom")
+	if info, _ := restored.ClientInfo("custom"); info.Limits.Capacity != 3 {
+		t.Fatalf("override is not restored: %+v", info.Limits)
+	}
+}
+
+func TestLoadSnapshotMissingFile(t *testing.T) {
+	rl := newTestRateLimiter(t, testSnapshotConfig)
+	if err := rl.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("missing snapshot should not be an error, got %v", err)
+	}
+}
+
+func TestRestoreSkipsClients(t *testing.T) {
+	rl := newTestRateLimiter(t, testSnapshotConfig)
+	rl.TakeTokens("active", 4)
+	rl.TakeTokens("inactive", 4)
+	rl.TakeTokens("changed", 4)
+	rl.Ban("banned", time.Hour)
+	s := rl.Snapshot()
+	for i := range s.Clients {
+		switch s.Clients[i].Key {
+		case "inactive", "banned":
+			// неактивен дольше таймаута, но блокировка ещё действует
+			s.Clients[i].LastSeen = time.Now().Add(-time.Hour)
+		case "changed":
+			s.Clients[i].Limits.Capacity = 20
+		}
+	}
+	s.Overrides = map[string]config.ClientConfig{"invalid": {Capacity: 0}}
+
+	restored := newTestRateLimiter(t, testSnapshotConfig)
+	restored.Restore(s)
+
+	if got := remainingOf(restored, "active"); got != 6 {
+		t.Errorf("active client remaining = %d, want 6", got)
+	}
+	if _, ok := restored.ClientInfo("inactive"); ok {
+		t.Error("inactive client should not be restored")
+	}
+	if _, ok := restored.ClientInfo("changed"); ok {
+		t.Error("client with changed limits should not be restored")
+	}
+	if info, ok := restored.ClientInfo("banned"); !ok || info.BannedUntil == nil {
+		t.Error("banned client should be restored while the ban is active")
+	}
+	if _, ok := restored.Snapshot().Overrides["invalid"]; ok {
+		t.Error("invalid override should be skipped")
+	}
+}
@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindowLog хранит время каждого запроса за последнее окно
+// и разрешает не более limit запросов в любом окне длиной window.
+// Точный, но требует памяти пропорционально limit.
+type SlidingWindowLog struct {
+	limit  int           // максимальное количество запросов в окне
+	window time.Duration // размер окна
+	mu     sync.Mutex    // мьютекс защиты журнала
+	log    []time.Time   // время принятых запросов в порядке возрастания
+}
+
+// NewSlidingWindowLog создает ограничитель sliding window log
+func NewSlidingWindowLog(limit int, window time.Duration) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		limit:  limit,
+		window: window,
+		log:    make([]time.Time, 0, limit),
+	}
+}
+
+// evict удаляет из журнала запросы, вышедшие за окно, вызывается под мьютексом
+func (l *SlidingWindowLog) evict(now time.Time) {
+	border := now.Add(-l.window)
+	i := 0
+	for i < len(l.log) && !l.log[i].After(border) {
+		i++
+	}
+	l.log = l.log[i:]
+}
+
+// TakeToken разрешает запрос, если в текущем окне ещё есть место
+func (l *SlidingWindowLog) TakeToken() bool {
+	return l.TakeTokens(1)
+}
+
+// TakeTokens разрешает запрос стоимостью n (не больше лимита), запрос записывается в журнал n раз
+func (l *SlidingWindowLog) TakeTokens(n int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.evict(now)
+	n = clampCost(n, l.limit)
+	if len(l.log)+n > l.limit {
+		return false
+	}
+	for range n {
+		l.log = append(l.log, now)
+	}
+	return true
+}
+
+// ReturnToken удаляет из журнала последний принятый запрос
+func (l *SlidingWindowLog) ReturnToken() {
+	l.ReturnTokens(1)
+}
+
+// ReturnTokens удаляет из журнала n последних записей
+func (l *SlidingWindowLog) ReturnTokens(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = l.log[:len(l.log)-min(clampCost(n, l.limit), len(l.log))]
+}
+
+// State возвращает свободное место в окне и время освобождения места для запроса стоимостью n
+func (l *SlidingWindowLog) State(n int) State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.evict(now)
+	n = clampCost(n, l.limit)
+
+	state := State{
+		Limit:     l.limit,
+		Remaining: l.limit - len(l.log),
+	}
+	if len(l.log) > 0 {
+		state.Reset = l.log[len(l.log)-1].Add(l.window).Sub(now)
+	}
+	if state.Remaining < 0 {
+		state.Remaining = 0
+	}
+	// место освободится, когда из окна выйдут самые старые записи
+	if expire := len(l.log) + n - l.limit; expire > 0 {
+		state.RetryAfter = l.log[expire-1].Add(l.window).Sub(now)
+	}
+	return state
+}
+
+// Snapshot возвращает журнал запросов
+func (l *SlidingWindowLog) Snapshot() LimiterSnapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.evict(time.Now())
+	return LimiterSnapshot{Log: append([]time.Time(nil), l.log...)}
+}
+
+// Restore восстанавливает журнал, запросы вне окна отбрасываются
+func (l *SlidingWindowLog) Restore(s LimiterSnapshot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log[:0], s.Log...)
+	if len(l.log) > l.limit {
+		l.log = l.log[len(l.log)-l.limit:]
+	}
+	l.evict(time.Now())
+}
+
+// SlidingWindowCounter приближает скользящее окно по двум счетчикам:
+// текущего и предыдущего фиксированных окон. Счетчик предыдущего окна
+// учитывается пропорционально его доле, попадающей в скользящее окно.
+type SlidingWindowCounter struct {
+	limit       int           // максимальное количество запросов в окне
+	window      time.Duration // размер окна
+	mu          sync.Mutex    // мьютекс защиты счетчиков
+	windowStart time.Time     // начало текущего фиксированного окна
+	current     int           // запросов в текущем окне
+	previous    int           // запросов в предыдущем окне
+}
+
+// NewSlidingWindowCounter создает ограничитель sliding window counter
+func NewSlidingWindowCounter(limit int, window time.Duration) *SlidingWindowCounter {
+	return &SlidingWindowCounter{
+		limit:       limit,
+		window:      window,
+		windowStart: time.Now().Truncate(window),
+	}
+}
+
+// advance сдвигает фиксированные окна к текущему времени, вызывается под мьютексом
+func (c *SlidingWindowCounter) advance(now time.Time) {
+	start := now.Truncate(c.window)
+	switch {
+	case start.Equal(c.windowStart):
+		return
+	case start.Sub(c.windowStart) == c.window:
+		c.previous = c.current
+	default:
+		c.previous = 0
+	}
+	c.current = 0
+	c.windowStart = start
+}
+
+// estimate возвращает оценку количества запросов в скользящем окне
+func (c *SlidingWindowCounter) estimate(now time.Time) float64 {
+	elapsed := float64(now.Sub(c.windowStart)) / float64(c.window)
+	return float64(c.previous)*(1-elapsed) + float64(c.current)
+}
+
+// TakeToken разрешает запрос, если оценка запросов в окне меньше лимита
+func (c *SlidingWindowCounter) TakeToken() bool {
+	return c.TakeTokens(1)
+}
+
+// TakeTokens разрешает запрос стоимостью n (не больше лимита), если оценка с его учётом не превышает лимит
+func (c *SlidingWindowCounter) TakeTokens(n int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.advance(now)
+	n = clampCost(n, c.limit)
+	if c.estimate(now)+float64(n) > float64(c.limit) {
+		return false
+	}
+	c.current += n
+	return true
+}
+
+// ReturnToken уменьшает счетчик текущего окна
+func (c *SlidingWindowCounter) ReturnToken() {
+	c.ReturnTokens(1)
+}
+
+// ReturnTokens уменьшает счетчик текущего окна на n
+func (c *SlidingWindowCounter) ReturnTokens(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(time.Now())
+	c.current = max(c.current-clampCost(n, c.limit), 0)
+}
+
+// State возвращает оценку свободного места в окне и время его освобождения для запроса стоимостью n
+func (c *SlidingWindowCounter) State(n int) State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.advance(now)
+	n = clampCost(n, c.limit)
+
+	estimate := c.estimate(now)
+	state := State{
+		Limit:     c.limit,
+		Remaining: int(float64(c.limit) - estimate),
+	}
+	if state.Remaining < 0 {
+		state.Remaining = 0
+	}
+
+	// оценка обнуляется, когда оба окна перестают попадать в скользящее окно
+	switch {
+	case c.current > 0:
+		state.Reset = c.windowStart.Add(2 * c.window).Sub(now)
+	case c.previous > 0:
+		state.Reset = c.windowStart.Add(c.window).Sub(now)
+	}
+
+	if estimate+float64(n) > float64(c.limit) {
+		state.RetryAfter = max(c.retryAfter(now, n), 0)
+	}
+	return state
+}
+
+// retryAfter вычисляет, когда оценка запросов в окне опустится до limit-n
+func (c *SlidingWindowCounter) retryAfter(now time.Time, n int) time.Duration {
+	target := float64(c.limit - n)
+	w := float64(c.window)
+	// в текущем окне доля предыдущего окна уменьшается линейно
+	if float64(c.current) <= target && c.previous > 0 {
+		fraction := 1 - (target-float64(c.current))/float64(c.previous)
+		return c.windowStart.Add(time.Duration(fraction * w)).Sub(now)
+	}
+	// иначе ждём следующего окна, в котором текущий счетчик станет предыдущим
+	fraction := 0.0
+	if c.current > 0 {
+		fraction = 1 - target/float64(c.current)
+	}
+	return c.windowStart.Add(c.window + time.Duration(fraction*w)).Sub(now)
+}
+
+// Snapshot возвращает счетчики окон
+func (c *SlidingWindowCounter) Snapshot() LimiterSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return LimiterSnapshot{
+		WindowStart: c.windowStart,
+		Current:     c.current,
+		Previous:    c.previous,
+	}
+}
+
+// Restore восстанавливает счетчики и сдвигает окна к текущему времени
+func (c *SlidingWindowCounter) Restore(s LimiterSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s.WindowStart.IsZero() {
+		return
+	}
+	c.windowStart = s.WindowStart.Truncate(c.window)
+	c.current = s.Current
+	c.previous = s.Previous
+	c.advance(time.Now())
+}
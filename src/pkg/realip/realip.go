@@ -0,0 +1,169 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"strings"
+)
+
+// Resolver определяет настоящий адрес клиента с учётом доверенных прокси.
+// Заголовки X-Forwarded-For и Forwarded учитываются только если запрос
+// пришёл с доверенного адреса, иначе их может подделать любой клиент.
+// Нулевой Resolver (или nil) не доверяет никому.
+type Resolver struct {
+	trusted []netip.Prefix // сети доверенных прокси
+}
+
+// NewResolver создает Resolver по списку CIDR (одиночный адрес считается /32 или /128)
+func NewResolver(cidrs []string) (*Resolver, error) {
+	r := &Resolver{trusted: make([]netip.Prefix, 0, len(cidrs))}
+	for _, cidr := range cidrs {
+		prefix, err := ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		r.trusted = append(r.trusted, prefix)
+	}
+	return r, nil
+}
+
+// ParsePrefix разбирает CIDR или одиночный адрес
+func ParsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// IsTrusted проверяет, входит ли адрес в список доверенных прокси
+func (r *Resolver) IsTrusted(addr netip.Addr) bool {
+	if r == nil || !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrustedAddr проверяет сетевой адрес соединения (например, из net.Conn.RemoteAddr)
+func (r *Resolver) IsTrustedAddr(addr net.Addr) bool {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip, _ := netip.AddrFromSlice(tcpAddr.IP)
+		return r.IsTrusted(ip)
+	}
+	return r.IsTrusted(parseHost(addr.String()))
+}
+
+// FromTrustedProxy проверяет, что запрос пришёл непосредственно от доверенного прокси
+func (r *Resolver) FromTrustedProxy(req *http.Request) bool {
+	return r.IsTrusted(parseHost(req.RemoteAddr))
+}
+
+// ClientIP возвращает адрес клиента. Если запрос пришёл от доверенного прокси,
+// цепочка адресов из Forwarded/X-Forwarded-For просматривается справа налево
+// до первого недоверенного адреса.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer := parseHost(req.RemoteAddr)
+	if !peer.IsValid() {
+		return req.RemoteAddr
+	}
+	if !r.IsTrusted(peer) {
+		return peer.String()
+	}
+
+	chain := forwardedChain(req.Header)
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr := chain[i]
+		if !addr.IsValid() {
+			break
+		}
+		client = addr
+		if !r.IsTrusted(addr) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// SetXForwarded выставляет заголовки X-Forwarded-* для запроса к бэкенду.
+// Для доверенных источников входящая цепочка X-Forwarded-For сохраняется
+// и дополняется адресом источника, X-Forwarded-Proto/Host сохраняются, если были заданы,
+// для остальных цепочка начинается заново.
+func (r *Resolver) SetXForwarded(pr *httputil.ProxyRequest) {
+	trusted := r.IsTrusted(parseHost(pr.In.RemoteAddr))
+	if trusted {
+		pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+	}
+	pr.SetXForwarded()
+	if !trusted {
+		return
+	}
+	for _, h := range []string{"X-Forwarded-Proto", "X-Forwarded-Host"} {
+		if v := pr.In.Header.Get(h); v != "" {
+			pr.Out.Header.Set(h, v)
+		}
+	}
+}
+
+// forwardedChain возвращает цепочку адресов из заголовка Forwarded (RFC 7239),
+// а если его нет - из X-Forwarded-For. Неразобранные элементы возвращаются нулевыми.
+func forwardedChain(h http.Header) []netip.Addr {
+	var chain []netip.Addr
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				chain = append(chain, parseForwardedFor(element))
+			}
+		}
+		return chain
+	}
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, element := range strings.Split(value, ",") {
+			chain = append(chain, parseHost(strings.TrimSpace(element)))
+		}
+	}
+	return chain
+}
+
+// parseForwardedFor достаёт адрес из параметра for= одного элемента заголовка Forwarded
+func parseForwardedFor(element string) netip.Addr {
+	for _, pair := range strings.Split(element, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.EqualFold(key, "for") {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		return parseHost(value)
+	}
+	return netip.Addr{}
+}
+
+// parseHost разбирает адрес вида "ip", "ip:port", "[ipv6]" или "[ipv6]:port"
+func parseHost(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
@@ -0,0 +1,152 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificates = errors.New("no certificates configured")
+
+// Entry - пара сертификат/ключ и имена хостов, для которых она выдаётся
+type Entry struct {
+	Hosts    []string // имена хостов (поддерживается "*.example.com"), пустой список - только по умолчанию
+	CertFile string   // путь до сертификата (PEM)
+	KeyFile  string   // путь до ключа (PEM)
+}
+
+// загруженный сертификат и время изменения файлов на момент загрузки
+type loaded struct {
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// CertStore хранит сертификаты для TLS-терминации, выбирает их по SNI
+// и перечитывает файлы при их изменении
+type CertStore struct {
+	entries []Entry
+	mu      sync.RWMutex
+	certs   []loaded // сертификаты в том же порядке, что и entries
+}
+
+// NewCertStore загружает все сертификаты, первый из них используется по умолчанию
+func NewCertStore(entries []Entry) (*CertStore, error) {
+	if len(entries) == 0 {
+		return nil, ErrNoCertificates
+	}
+	s := &CertStore{
+		entries: entries,
+		certs:   make([]loaded, len(entries)),
+	}
+	for i, entry := range entries {
+		cert, err := load(entry)
+		if err != nil {
+			return nil, err
+		}
+		s.certs[i] = cert
+	}
+	return s, nil
+}
+
+// load читает пару сертификат/ключ
+func load(entry Entry) (loaded, error) {
+	certInfo, err := os.Stat(entry.CertFile)
+	if err != nil {
+		return loaded{}, err
+	}
+	keyInfo, err := os.Stat(entry.KeyFile)
+	if err != nil {
+		return loaded{}, err
+	}
+	cert, err := tls.LoadX509KeyPair(entry.CertFile, entry.KeyFile)
+	if err != nil {
+		return loaded{}, fmt.Errorf("failed to load certificate %s: %w", entry.CertFile, err)
+	}
+	return loaded{cert: &cert, certMod: certInfo.ModTime(), keyMod: keyInfo.ModTime()}, nil
+}
+
+// GetCertificate выбирает сертификат по SNI: точное имя, затем wildcard, затем сертификат по умолчанию.
+// Подходит для tls.Config.GetCertificate.
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if name != "" {
+		for i, entry := range s.entries {
+			for _, host := range entry.Hosts {
+				if matchHost(strings.ToLower(host), name) {
+					return s.certs[i].cert, nil
+				}
+			}
+		}
+	}
+	return s.certs[0].cert, nil
+}
+
+// matchHost сравнивает имя хоста с шаблоном, "*.example.com" подходит к одному уровню поддомена
+func matchHost(pattern, name string) bool {
+	if pattern == name {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(pattern, "*")
+	if !ok || !strings.HasPrefix(suffix, ".") {
+		return false
+	}
+	prefix, ok := strings.CutSuffix(name, suffix)
+	return ok && prefix != "" && !strings.Contains(prefix, ".")
+}
+
+// Reload перечитывает сертификаты, файлы которых изменились.
+// При ошибке загрузки продолжает использоваться прежний сертификат.
+func (s *CertStore) Reload() {
+	for i, entry := range s.entries {
+		certInfo, err := os.Stat(entry.CertFile)
+		if err != nil {
+			log.Printf("Certificate reload: %v", err)
+			continue
+		}
+		keyInfo, err := os.Stat(entry.KeyFile)
+		if err != nil {
+			log.Printf("Certificate reload: %v", err)
+			continue
+		}
+
+		s.mu.RLock()
+		current := s.certs[i]
+		s.mu.RUnlock()
+		if certInfo.ModTime().Equal(current.certMod) && keyInfo.ModTime().Equal(current.keyMod) {
+			continue
+		}
+
+		cert, err := load(entry)
+		if err != nil {
+			log.Printf("Certificate reload: %v, keeping previous certificate", err)
+			continue
+		}
+		s.mu.Lock()
+		s.certs[i] = cert
+		s.mu.Unlock()
+		log.Printf("Certificate %s reloaded", entry.CertFile)
+	}
+}
+
+// Watch периодически проверяет файлы сертификатов и перечитывает изменённые, пока не закрыт stop
+func (s *CertStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Reload()
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert создаёт самоподписанный сертификат с именем cn и записывает пару в dir
+func writeCert(t *testing.T, dir, name, cn string) Entry {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := Entry{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err := os.WriteFile(entry.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(entry.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+// commonName возвращает CN выданного сертификата
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	def := writeCert(t, dir, "default", "default.test")
+	api := writeCert(t, dir, "api", "api.example.com")
+	api.Hosts = []string{"API.example.com"}
+	wildcard := writeCert(t, dir, "wildcard", "wildcard.example.com")
+	wildcard.Hosts = []string{"*.example.com"}
+
+	store, err := NewCertStore([]Entry{def, api, wildcard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"api.example.com", "api.example.com"},
+		{"API.Example.com.", "api.example.com"},
+		{"www.example.com", "wildcard.example.com"},
+		{"a.b.example.com", "default.test"},
+		{"example.com", "default.test"},
+		{"other.test", "default.test"},
+		{"", "default.test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := commonName(t, cert); got != tt.want {
+				t.Fatalf("certificate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCertStoreErrors(t *testing.T) {
+	if _, err := NewCertStore(nil); err != ErrNoCertificates {
+		t.Fatalf("err = %v, want ErrNoCertificates", err)
+	}
+
+	dir := t.TempDir()
+	entry := writeCert(t, dir, "a", "a.test")
+	entry.KeyFile = writeCert(t, dir, "b", "b.test").KeyFile // ключ от другого сертификата
+	if _, err := NewCertStore([]Entry{entry}); err == nil {
+		t.Fatal("mismatched key is accepted")
+	}
+	if _, err := NewCertStore([]Entry{{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: entry.KeyFile}}); err == nil {
+		t.Fatal("missing certificate is accepted")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	entry := writeCert(t, dir, "site", "old.test")
+	store, err := NewCertStore([]Entry{entry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := func() string {
+		cert, _ := store.GetCertificate(&tls.ClientHelloInfo{})
+		return commonName(t, cert)
+	}
+
+	// файлы не менялись - сертификат остаётся прежним
+	store.Reload()
+	if got := current(); got != "old.test" {
+		t.Fatalf("certificate = %s, want old.test", got)
+	}
+
+	// новый сертификат подхватывается по времени изменения файлов
+	writeCert(t, dir, "site", "new.test")
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{entry.CertFile, entry.KeyFile} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Reload()
+	if got := current(); got != "new.test" {
+		t.Fatalf("certificate = %s, want new.test", got)
+	}
+
+	// битый файл не заменяет рабочий сертификат
+	if err := os.WriteFile(entry.CertFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(entry.CertFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	store.Reload()
+	if got := current(); got != "new.test" {
+		t.Fatalf("certificate = %s, want new.test", got)
+	}
+}
+
+// сертификат выбирается по SNI при реальном TLS-рукопожатии
+func TestHandshakeSNI(t *testing.T) {
+	dir := t.TempDir()
+	def := writeCert(t, dir, "default", "default.test")
+	api := writeCert(t, dir, "api", "api.example.com")
+	api.Hosts = []string{"api.example.com"}
+	store, err := NewCertStore([]Entry{def, api})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		defer serverConn.Close()
+		tls.Server(serverConn, &tls.Config{GetCertificate: store.GetCertificate}).Handshake()
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{ServerName: "api.example.com", InsecureSkipVerify: true})
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.ConnectionState().PeerCertificates[0].Subject.CommonName; got != "api.example.com" {
+		t.Fatalf("certificate = %s, want api.example.com", got)
+	}
+}
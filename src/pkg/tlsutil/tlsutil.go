@@ -0,0 +1,97 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// версии TLS в конфиге
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion разбирает версию TLS вида "1.2", пустая строка - TLS 1.2
+func ParseVersion(s string) (uint16, error) {
+	if s == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := versions[strings.TrimPrefix(strings.ToLower(s), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q", s)
+	}
+	return version, nil
+}
+
+// ParseCipherSuites переводит названия наборов шифров (например, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+// в их идентификаторы. Небезопасные наборы не принимаются. Для TLS 1.3 наборы не настраиваются.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// NewServerConfig собирает настройки TLS-терминации: сертификаты по SNI из хранилища,
+// минимальная версия и разрешённые наборы шифров
+func NewServerConfig(store *CertStore, minVersion string, cipherSuites []string) (*tls.Config, error) {
+	version, err := ParseVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := ParseCipherSuites(cipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetCertificate: store.GetCertificate,
+		MinVersion:     version,
+		CipherSuites:   suites,
+	}, nil
+}
+
+// NewClientConfig собирает настройки TLS-клиента для соединения с бэкендом:
+// CA-бандл для проверки сертификата, клиентский сертификат для mTLS и имя сервера для SNI
+func NewClientConfig(caFile, certFile, keyFile, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,18 @@
+#!/bin/bash
+
+# Генерация самоподписанного сертификата для проверки TLS-терминации на балансировщике
+# Использование: sh scripts/gen_certs.sh [имя_хоста] [папка]
+
+HOST="${1:-localhost}"
+CERT_DIR="${2:-config/certs}"
+
+mkdir -p "$CERT_DIR"
+
+openssl req -x509 -newkey rsa:2048 -nodes -days 365 \
+    -keyout "$CERT_DIR/$HOST.key" \
+    -out "$CERT_DIR/$HOST.crt" \
+    -subj "/CN=$HOST" \
+    -addext "subjectAltName=DNS:$HOST" 2>/dev/null
+
+echo "Certificate: $CERT_DIR/$HOST.crt"
+echo "Key: $CERT_DIR/$HOST.key"